@@ -0,0 +1,57 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/luxfi/log"
+	"github.com/luxfi/vms/components/chain"
+)
+
+var errNotChainVM = errors.New("VM does not implement ChainStateVM")
+
+// ChainStateVM is a VM whose blocks are cached by a chain.State that is
+// created by Build.
+type ChainStateVM interface {
+	// ChainConfig returns the configuration of the VM's chain.State.
+	ChainConfig() (*chain.Config, error)
+	// SetChainState is called with the chain.State created from the
+	// configuration returned by ChainConfig.
+	SetChainState(*chain.State)
+}
+
+// Build creates a VM from [f] along with the chain.State caching its blocks,
+// making sure that both use [log].
+//
+// The VM is created by passing [log] to [f]. The configuration returned by
+// the VM's ChainConfig is then used to create the State, with [log] used as
+// the State's logger unless the configuration already sets one. Finally the
+// State is handed to the VM with SetChainState before both are returned.
+func Build(f Factory, log log.Logger) (interface{}, *chain.State, error) {
+	vmIntf, err := f.New(log)
+	if err != nil {
+		return nil, nil, err
+	}
+	vm, ok := vmIntf.(ChainStateVM)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %T", errNotChainVM, vmIntf)
+	}
+
+	config, err := vm.ChainConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	stateConfig := *config
+	if stateConfig.Log == nil {
+		stateConfig.Log = log
+	}
+	state, err := chain.NewState(&stateConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	vm.SetChainState(state)
+	return vmIntf, state, nil
+}
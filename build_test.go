@@ -0,0 +1,68 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/consensus/engine/chain/block/blocktest"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/log"
+	"github.com/luxfi/vms/components/chain"
+)
+
+var _ ChainStateVM = (*testChainVM)(nil)
+
+type testChainVM struct {
+	log     log.Logger
+	genesis *blocktest.Block
+	state   *chain.State
+}
+
+func (vm *testChainVM) ChainConfig() (*chain.Config, error) {
+	return &chain.Config{
+		LastAcceptedBlock: vm.genesis,
+		GetBlock: func(context.Context, ids.ID) (block.Block, error) {
+			return nil, database.ErrNotFound
+		},
+	}, nil
+}
+
+func (vm *testChainVM) SetChainState(state *chain.State) {
+	vm.state = state
+}
+
+type testChainFactory struct {
+	genesis *blocktest.Block
+}
+
+func (f testChainFactory) New(log log.Logger) (interface{}, error) {
+	return &testChainVM{
+		log:     log,
+		genesis: f.genesis,
+	}, nil
+}
+
+func TestBuild(t *testing.T) {
+	require := require.New(t)
+
+	genesis := &blocktest.Block{}
+	genesis.IDV = ids.GenerateTestID()
+	logger := log.NewNoOpLogger()
+
+	vmIntf, state, err := Build(testChainFactory{genesis: genesis}, logger)
+	require.NoError(err)
+	vm := vmIntf.(*testChainVM)
+	require.Equal(logger, vm.log)
+	require.Same(state, vm.state)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+
+	_, _, err = Build(testFactory{}, logger)
+	require.ErrorIs(err, errNotChainVM)
+}
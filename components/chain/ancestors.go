@@ -0,0 +1,51 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+)
+
+// Ancestors returns the block [blkID] followed by its ancestors, newest
+// first, such as to serve a GetAncestors request. At most [maxBlocks] blocks
+// are returned, and the walk stops once the genesis block or the last
+// accepted block is reached.
+//
+// Blocks are looked up as by [State.GetBlock], so cached blocks are served
+// from the caches and the others are loaded from the VM. An error is returned
+// if [blkID] can't be found. If an ancestor can't be found, the blocks found
+// so far are returned.
+func (s *State) Ancestors(ctx context.Context, blkID ids.ID, maxBlocks int) ([]block.Block, error) {
+	if maxBlocks <= 0 {
+		return nil, nil
+	}
+
+	blk, err := s.GetBlock(ctx, blkID)
+	if err != nil {
+		return nil, err
+	}
+
+	lastAcceptedKey := s.lastAcceptedKey()
+	blks := []block.Block{blk}
+	for len(blks) < maxBlocks && blk.Height() != 0 && blk.(*BlockWrapper).key() != lastAcceptedKey {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		blk, err = s.GetBlock(ctx, blk.Parent())
+		if errors.Is(err, database.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, blk)
+	}
+	return blks, nil
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestAncestors(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	accepted := chaintest.NewBlock(genesis)
+	blk1 := chaintest.NewBlock(accepted)
+	blk2 := chaintest.NewBlock(blk1)
+	blk3 := chaintest.NewBlock(blk2)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		accepted.ID(): accepted,
+		blk1.ID():     blk1,
+		blk2.ID():     blk2,
+		blk3.ID():     blk3,
+	}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	acceptedBlk, err := state.GetBlock(ctx, accepted.ID())
+	require.NoError(err)
+	require.NoError(acceptedBlk.Verify(ctx))
+	require.NoError(acceptedBlk.Accept(ctx))
+
+	// [blk1] is served from the cache, the others are loaded from the VM.
+	bw1, err := state.GetBlock(ctx, blk1.ID())
+	require.NoError(err)
+	require.NoError(bw1.Verify(ctx))
+
+	ancestors, err := state.Ancestors(ctx, blk3.ID(), 10)
+	require.NoError(err)
+	require.Len(ancestors, 4)
+	for i, expected := range []block.Block{blk3, blk2, blk1, accepted} {
+		require.Equal(expected.ID(), ancestors[i].ID())
+	}
+	require.Same(bw1, ancestors[2])
+	require.Same(acceptedBlk, ancestors[3])
+
+	ancestors, err = state.Ancestors(ctx, blk3.ID(), 2)
+	require.NoError(err)
+	require.Len(ancestors, 2)
+	require.Equal(blk2.ID(), ancestors[1].ID())
+
+	// The walk stops at genesis.
+	ancestors, err = state.Ancestors(ctx, genesis.ID(), 10)
+	require.NoError(err)
+	require.Len(ancestors, 1)
+
+	empty, err := state.Ancestors(ctx, blk3.ID(), 0)
+	require.NoError(err)
+	require.Empty(empty)
+
+	_, err = state.Ancestors(ctx, ids.GenerateTestID(), 10)
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestAncestorsMissingAncestor(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	missing := chaintest.NewBlock(genesis)
+	child := chaintest.NewBlock(missing)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+
+	ancestors, err := state.Ancestors(context.Background(), child.ID(), 10)
+	require.NoError(err)
+	require.Len(ancestors, 1)
+	require.Equal(child.ID(), ancestors[0].ID())
+}
@@ -0,0 +1,236 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+)
+
+var (
+	errNonContiguousBatch = errors.New("batch is not a contiguous chain")
+	errNotProcessing      = errors.New("block is not processing")
+)
+
+// BatchVerifyError is returned by [State.VerifyBatch] when a block in the
+// batch could not be verified. All blocks before [Index] were verified.
+type BatchVerifyError struct {
+	// Index of the first block in the batch that failed verification.
+	Index int
+	// BlkID is the ID of the block at [Index].
+	BlkID ids.ID
+	// Err is the reason the block failed verification.
+	Err error
+}
+
+func (e *BatchVerifyError) Error() string {
+	return fmt.Sprintf("failed to verify block %s at index %d: %s", e.BlkID, e.Index, e.Err)
+}
+
+func (e *BatchVerifyError) Unwrap() error {
+	return e.Err
+}
+
+// BatchAcceptError is returned by [State.AcceptRange] when a block in the
+// range could not be accepted. All blocks before [Index] were accepted.
+type BatchAcceptError struct {
+	// Index of the first block in the range that wasn't accepted.
+	Index int
+	// BlkID is the ID of the block at [Index].
+	BlkID ids.ID
+	// Err is the reason the block wasn't accepted.
+	Err error
+}
+
+func (e *BatchAcceptError) Error() string {
+	return fmt.Sprintf("failed to accept block %s at index %d: %s", e.BlkID, e.Index, e.Err)
+}
+
+func (e *BatchAcceptError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyBatch verifies [blks], which must be ordered from parent to child with
+// each block being the child of the block before it.
+//
+// Blocks that are already processing are not verified again. Verification
+// stops at the first failure, which is reported as a *BatchVerifyError, and
+// only the blocks before it are added to verifiedBlocks.
+func (s *State) VerifyBatch(ctx context.Context, blks []block.Block) error {
+	return s.verifyBatch(blks, func(bw *BlockWrapper) error {
+		return bw.Verify(ctx)
+	})
+}
+
+// VerifyBatchWithContext is [VerifyBatch], except that each block that should
+// be verified with a block context, as reported by
+// [BlockWrapper.ShouldVerifyWithContext], is verified with [blockCtx]. The
+// other blocks are verified without a context.
+func (s *State) VerifyBatchWithContext(ctx context.Context, blks []block.Block, blockCtx *block.Context) error {
+	return s.verifyBatch(blks, func(bw *BlockWrapper) error {
+		shouldVerify, err := bw.ShouldVerifyWithContext(ctx)
+		if err != nil {
+			return err
+		}
+		if shouldVerify {
+			return bw.VerifyWithContext(ctx, blockCtx)
+		}
+		return bw.Verify(ctx)
+	})
+}
+
+func (s *State) verifyBatch(blks []block.Block, verify func(*BlockWrapper) error) error {
+	for i, blk := range blks {
+		blkID := s.key(blk)
+		if i > 0 && blk.Parent() != blks[i-1].ID() {
+			return &BatchVerifyError{
+				Index: i,
+				BlkID: blkID,
+				Err:   fmt.Errorf("%w: parent %s != %s", errNonContiguousBatch, blk.Parent(), blks[i-1].ID()),
+			}
+		}
+
+		if s.IsProcessing(blkID) {
+			continue
+		}
+
+		if err := verify(s.WrapBlock(blk)); err != nil {
+			return &BatchVerifyError{
+				Index: i,
+				BlkID: blkID,
+				Err:   err,
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptRange accepts [blks], which must be processing and ordered from parent
+// to child, with the first block being a child of the last accepted block and
+// each other block being the child of the block before it. This is equivalent
+// to accepting each block in order, except that the caches are updated and the
+// last accepted block is set once for the whole range.
+//
+// If a block is not processing or the range is not contiguous, a
+// *BatchAcceptError is returned and no block is accepted.
+//
+// If the underlying Accept of a block fails, accepting stops and a
+// *BatchAcceptError is returned. The VM can't undo the acceptance of the blocks
+// before the failed block, so they stay accepted by State and the last of them
+// becomes the last accepted block. The failed block and the blocks after it
+// are rolled back: they are removed from the verified blocks and cached as
+// unverified, so they must be verified again before they can be accepted.
+//
+// Every block whose underlying Accept is called is traced by a
+// [Config.Tracer] span, as by [BlockWrapper.Accept].
+func (s *State) AcceptRange(ctx context.Context, blks []*BlockWrapper) error {
+	if s.isClosed() {
+		return ErrClosed
+	}
+
+	parentID := s.lastAcceptedKey()
+	for i, bw := range blks {
+		blkID := bw.key()
+		if bw.Parent() != parentID {
+			return &BatchAcceptError{
+				Index: i,
+				BlkID: blkID,
+				Err:   fmt.Errorf("%w: parent %s != %s", errNonContiguousBatch, bw.Parent(), parentID),
+			}
+		}
+		if verifiedBlk, ok := s.verifiedBlocks.Get(blkID); !ok || verifiedBlk != bw {
+			return &BatchAcceptError{
+				Index: i,
+				BlkID: blkID,
+				Err:   errNotProcessing,
+			}
+		}
+		parentID = blkID
+	}
+
+	var (
+		ctxs []context.Context
+		ends []func(error)
+		err  error
+	)
+	for i, bw := range blks {
+		blkCtx, end := s.startSpan(ctx, acceptSpan, bw)
+		blkID := bw.key()
+		if acceptErr := s.decide(blkCtx, blkID, bw.Block.Accept); acceptErr != nil {
+			err = &BatchAcceptError{
+				Index: i,
+				BlkID: blkID,
+				Err:   acceptErr,
+			}
+			end(err)
+			break
+		}
+		ctxs = append(ctxs, blkCtx)
+		ends = append(ends, end)
+	}
+	// As for [BlockWrapper.Accept], the spans of the accepted blocks end once
+	// the caches were updated.
+	s.acceptedRange(ctxs, blks[:len(ctxs)])
+	for _, end := range ends {
+		end(nil)
+	}
+	if err != nil {
+		s.rollbackRange(blks[len(ctxs):])
+	}
+	return err
+}
+
+// rollbackRange moves [blks], the blocks of a range that weren't accepted,
+// from the verified blocks back to the unverified blocks.
+func (s *State) rollbackRange(blks []*BlockWrapper) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, bw := range blks {
+		blkID := bw.key()
+		s.removeVerified(blkID)
+		s.unverifiedBlocks.Put(blkID, bw)
+	}
+}
+
+// acceptedRange updates the caches once the underlying blocks of [blks], a
+// contiguous range extending the last accepted block, were accepted. [ctxs]
+// holds the context of the acceptance of each block.
+func (s *State) acceptedRange(ctxs []context.Context, blks []*BlockWrapper) {
+	if len(blks) == 0 {
+		return
+	}
+
+	// As in [BlockWrapper.Accept], the decided blocks are updated first and
+	// without holding [s.lock].
+	for _, bw := range blks {
+		s.decidedBlocks.Put(bw.key(), decidedBlock{
+			BlockWrapper: bw,
+			accepted:     true,
+		})
+	}
+
+	processingTimes := make([]time.Duration, len(blks))
+	lastAccepted := blks[len(blks)-1]
+	s.lock.Lock()
+	for i, bw := range blks {
+		blkID := bw.key()
+		processingTimes[i] = s.removeVerified(blkID)
+		s.missingBlocks.Evict(blkID)
+		s.acceptedHeights.Put(bw.Height(), blkID)
+	}
+	s.lastAcceptedBlock = lastAccepted
+	s.metrics.setLastAccepted(lastAccepted)
+	s.evictOrphans()
+	s.lock.Unlock()
+
+	for i, bw := range blks {
+		bw.accepted(ctxs[i], processingTimes[i])
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/core/choices"
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var errTestVerify = errors.New("test verify error")
+
+func TestVerifyBatch(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blk2 := chaintest.NewBlock(blk1)
+	blk3 := chaintest.NewBlock(blk2)
+	blk4 := chaintest.NewBlock(blk3)
+	blk3.VerifyV = errTestVerify
+	blks := chaintest.Blocks{
+		blk1.ID(): blk1,
+		blk2.ID(): blk2,
+		blk3.ID(): blk3,
+		blk4.ID(): blk4,
+	}
+	state, err := NewState(newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	ctx := context.Background()
+	err = state.VerifyBatch(ctx, []block.Block{blk1, blk2, blk3, blk4})
+	require.ErrorIs(err, errTestVerify)
+
+	var batchErr *BatchVerifyError
+	require.ErrorAs(err, &batchErr)
+	require.Equal(2, batchErr.Index)
+	require.Equal(blk3.ID(), batchErr.BlkID)
+
+	require.True(state.IsProcessing(blk1.ID()))
+	require.True(state.IsProcessing(blk2.ID()))
+	require.False(state.IsProcessing(blk3.ID()))
+	require.False(state.IsProcessing(blk4.ID()))
+
+	// Resuming from the failed index re-uses the verified parents.
+	blk1.VerifyV = errTestVerify
+	blk3.VerifyV = nil
+	require.NoError(state.VerifyBatch(ctx, []block.Block{blk1, blk2, blk3, blk4}))
+	require.True(state.IsProcessing(blk3.ID()))
+	require.True(state.IsProcessing(blk4.ID()))
+}
+
+func TestVerifyBatchNonContiguous(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blk2 := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	err = state.VerifyBatch(context.Background(), []block.Block{blk1, blk2})
+	require.ErrorIs(err, errNonContiguousBatch)
+
+	var batchErr *BatchVerifyError
+	require.ErrorAs(err, &batchErr)
+	require.Equal(1, batchErr.Index)
+	require.True(state.IsProcessing(blk1.ID()))
+}
+
+func TestVerifyBatchWithContext(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blk2 := &testContextBlock{
+		Block:                   chaintest.NewBlock(blk1),
+		shouldVerifyWithContext: true,
+	}
+	blk3 := &testContextBlock{
+		Block: chaintest.NewBlock(blk2.Block),
+	}
+	blk4 := chaintest.NewBlock(blk3.Block)
+	blk4.VerifyV = errTestVerify
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	// Blocks without a context are still verified without one.
+	config.StrictVerifyContext = true
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blockCtx := &block.Context{PChainHeight: 1}
+	err = state.VerifyBatchWithContext(ctx, []block.Block{blk1, blk2, blk3, blk4}, blockCtx)
+	require.ErrorIs(err, errTestVerify)
+
+	var batchErr *BatchVerifyError
+	require.ErrorAs(err, &batchErr)
+	require.Equal(3, batchErr.Index)
+
+	require.True(state.IsProcessing(blk1.ID()))
+	require.True(state.IsProcessing(blk2.ID()))
+	require.True(state.IsProcessing(blk3.ID()))
+	require.False(state.IsProcessing(blk4.ID()))
+	require.Same(blockCtx, blk2.verifiedContext)
+	require.Nil(blk3.verifiedContext)
+	require.Equal(1, blk3.shouldVerifyWithContextCalls)
+}
+
+// newTestRange returns [length] verified wrappers, each the child of the one
+// before it, starting from a child of [genesis].
+func newTestRange(t *testing.T, state *State, genesis *chaintest.Block, length int) []*BlockWrapper {
+	t.Helper()
+
+	blks := chaintest.NewChain(genesis, length)
+	bws := make([]*BlockWrapper, length)
+	for i, blk := range blks {
+		bws[i] = state.WrapBlock(blk)
+		require.NoError(t, bws[i].Verify(context.Background()))
+	}
+	return bws
+}
+
+func TestAcceptRange(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	bws := newTestRange(t, state, genesis, 3)
+	require.NoError(state.AcceptRange(ctx, bws))
+	require.Same(bws[2], state.LastAcceptedBlock())
+	require.Empty(state.ProcessingIDs())
+	for _, bw := range bws {
+		status, ok := state.Status(bw.ID())
+		require.True(ok)
+		require.Equal(StatusAccepted, status)
+		blkID, err := state.GetBlockIDAtHeight(ctx, bw.Height())
+		require.NoError(err)
+		require.Equal(bw.ID(), blkID)
+		require.Equal(uint8(choices.Accepted), bw.Block.Status())
+	}
+}
+
+func TestAcceptRangeInvalid(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	bws := newTestRange(t, state, genesis, 3)
+
+	// The range must extend the last accepted block.
+	err = state.AcceptRange(ctx, bws[1:])
+	require.ErrorIs(err, errNonContiguousBatch)
+	var acceptErr *BatchAcceptError
+	require.ErrorAs(err, &acceptErr)
+	require.Zero(acceptErr.Index)
+
+	err = state.AcceptRange(ctx, []*BlockWrapper{bws[0], bws[2]})
+	require.ErrorIs(err, errNonContiguousBatch)
+
+	// Blocks must be processing.
+	unverified := state.WrapBlock(chaintest.NewBlock(bws[2].Block.(*chaintest.Block)))
+	err = state.AcceptRange(ctx, append(bws, unverified))
+	require.ErrorIs(err, errNotProcessing)
+	require.ErrorAs(err, &acceptErr)
+	require.Equal(3, acceptErr.Index)
+
+	// Nothing was accepted.
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+	require.Len(state.ProcessingIDs(), 3)
+	for _, bw := range bws {
+		require.Equal(uint8(choices.Processing), bw.Block.Status())
+	}
+}
+
+func TestAcceptRangePartialFailure(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	bws := newTestRange(t, state, genesis, 4)
+	bws[2].Block.(*chaintest.Block).AcceptV = errTestVerify
+
+	err = state.AcceptRange(ctx, bws)
+	require.ErrorIs(err, errTestVerify)
+	var acceptErr *BatchAcceptError
+	require.ErrorAs(err, &acceptErr)
+	require.Equal(2, acceptErr.Index)
+	require.Equal(bws[2].ID(), acceptErr.BlkID)
+
+	// The blocks accepted by the VM stay accepted, and the others are rolled
+	// back to unverified.
+	require.Same(bws[1], state.LastAcceptedBlock())
+	require.Equal(bws[1].ID(), state.LastAcceptedID())
+	require.Empty(state.ProcessingIDs())
+	for _, bw := range bws[:2] {
+		status, _ := state.Status(bw.ID())
+		require.Equal(StatusAccepted, status)
+		require.Equal(CacheLocationDecided, bw.CacheLocation())
+		blkID, err := state.GetBlockIDAtHeight(ctx, bw.Height())
+		require.NoError(err)
+		require.Equal(bw.ID(), blkID)
+	}
+	for _, bw := range bws[2:] {
+		status, _ := state.Status(bw.ID())
+		require.Equal(StatusUnverified, status)
+		require.Equal(CacheLocationUnverified, bw.CacheLocation())
+		_, err := state.GetBlockIDAtHeight(ctx, bw.Height())
+		require.ErrorIs(err, database.ErrNotFound)
+	}
+	require.Equal(uint8(choices.Processing), bws[3].Block.Status())
+	require.ErrorIs(state.AcceptRange(ctx, bws[2:]), errNotProcessing)
+
+	// The rest of the range can be accepted once it is verified again and the
+	// VM succeeds.
+	bws[2].Block.(*chaintest.Block).AcceptV = nil
+	for _, bw := range bws[2:] {
+		require.NoError(bw.Verify(ctx))
+	}
+	require.NoError(state.AcceptRange(ctx, bws[2:]))
+	require.Same(bws[3], state.LastAcceptedBlock())
+	require.Empty(state.ProcessingIDs())
+}
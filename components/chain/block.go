@@ -6,15 +6,44 @@ package chain
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/utils"
 )
 
 var (
 	_ block.Block             = (*BlockWrapper)(nil)
 	_ block.WithVerifyContext = (*BlockWrapper)(nil)
+	_ OracleBlock             = (*BlockWrapper)(nil)
+	_ OracleBlockWithContext  = (*BlockWrapper)(nil)
+	_ OracleBlockN            = (*BlockWrapper)(nil)
+	_ StateSummaryProvider    = (*BlockWrapper)(nil)
+
+	// ErrNotOracle is returned by [BlockWrapper.Options] if the underlying
+	// block is not an [OracleBlock].
+	ErrNotOracle = errors.New("block is not an oracle block")
+	// ErrDecisionTimeout is returned by [BlockWrapper.Accept] and
+	// [BlockWrapper.Reject] if the underlying block failed to be decided
+	// within [Config.DecisionTimeout].
+	ErrDecisionTimeout = errors.New("decision timed out")
+	// ErrNoStateSummary is returned by [BlockWrapper.StateSummary] if the
+	// underlying block is not a [StateSummaryProvider].
+	ErrNoStateSummary = errors.New("block does not provide a state summary")
 
 	errExpectedBlockWithVerifyContext = errors.New("expected block.WithVerifyContext")
+	errBlockAlreadyDecided            = errors.New("block already decided")
+	errTooManyProcessing              = errors.New("too many processing blocks")
+	errMissingParent                  = errors.New("missing parent")
+	errConflictingDecision            = errors.New("conflicting decision")
+	errExpectedAncestorVerifier       = errors.New("expected AncestorVerifier")
+	errUnexpectedParent               = errors.New("unexpected parent")
+	errRejectedParent                 = errors.New("parent was rejected")
+	errHeightDiscontinuity            = errors.New("height discontinuity")
+	errConflictingBytes               = errors.New("conflicting block bytes")
 )
 
 // BlockWrapper wraps a linear Block while adding a smart caching layer to improve
@@ -23,6 +52,54 @@ type BlockWrapper struct {
 	block.Block
 
 	state *State
+	// verifiedAt is the time the block was added to the verified blocks. It
+	// is protected by the lock of [state].
+	verifiedAt time.Time
+	// pinnedParent is true if the block pins its decided parent while it is
+	// verified. It is protected by the lock of [state].
+	pinnedParent bool
+	// strictContext is set by [State.WrapStrictContextBlock].
+	strictContext atomic.Bool
+	// live is true if the wrapper was created for an undecided block and
+	// has not been decided yet. It is only tracked by metered states.
+	live atomic.Bool
+	// siblings is shared by the options of an oracle block if
+	// [Config.ShareOptionParentState] is set.
+	siblings atomic.Pointer[optionSiblings]
+}
+
+// decided stops counting [bw] as a live wrapper.
+func (bw *BlockWrapper) decided() {
+	if bw.live.CompareAndSwap(true, false) {
+		bw.state.metrics.wrapperDecided()
+	}
+}
+
+// key returns the key of the block in the block caches.
+func (bw *BlockWrapper) key() ids.ID {
+	return bw.state.key(bw.Block)
+}
+
+// Unwrap returns the underlying block.
+func (bw *BlockWrapper) Unwrap() block.Block {
+	return bw.Block
+}
+
+// UnwrapAs returns the first block of type T found by unwrapping [blk]. [blk]
+// itself is checked first, followed by the blocks returned by successive calls
+// to Unwrap, such as those of nested BlockWrappers.
+func UnwrapAs[T block.Block](blk block.Block) (T, bool) {
+	for blk != nil {
+		if t, ok := blk.(T); ok {
+			return t, true
+		}
+		wrapper, ok := blk.(interface{ Unwrap() block.Block })
+		if !ok {
+			break
+		}
+		blk = wrapper.Unwrap()
+	}
+	return utils.Zero[T](), false
 }
 
 // Verify verifies the underlying block, evicts from the unverified block cache
@@ -30,66 +107,597 @@ type BlockWrapper struct {
 // Note: it is guaranteed that if a block passes verification it will be added to
 // consensus and eventually be decided ie. either Accept/Reject will be called
 // on [bw] removing it from [verifiedBlocks].
+//
+// If a wrapper of the block is already in [verifiedBlocks], whether [bw] or a
+// duplicate wrapper of the same block ID, the underlying block is not verified
+// again and nil is returned. [bw] is then not added, so that [verifiedBlocks]
+// keeps the wrapper held by consensus. If the cached wrapper has different
+// bytes than [bw], errConflictingBytes is returned instead.
+//
+// If the block has already been decided, if [Config.MaxProcessing] blocks are
+// already processing, or if [Config.StrictParents] is set and the parent of
+// the block is not processing or last accepted, it is not verified and an
+// error is returned.
+//
+// If [bw] was returned by [State.WrapStrictContextBlock], the underlying block
+// is verified with VerifyWithContext and a nil block context instead.
+//
+// Errors returned by the underlying block are wrapped with the ID and height
+// of the block.
 func (bw *BlockWrapper) Verify(ctx context.Context) error {
-	if err := bw.Block.Verify(ctx); err != nil {
+	if withCtx, ok := bw.strictContextBlock(); ok {
+		return bw.verify(ctx, true, false, func(ctx context.Context) error {
+			return withCtx.VerifyWithContext(ctx, nil)
+		})
+	}
+	return bw.verify(ctx, false, false, bw.Block.Verify)
+}
+
+// strictContextBlock returns the underlying block if [bw] was returned by
+// [State.WrapStrictContextBlock].
+func (bw *BlockWrapper) strictContextBlock() (block.WithVerifyContext, bool) {
+	if !bw.strictContext.Load() {
+		return nil, false
+	}
+	withCtx, ok := bw.Block.(block.WithVerifyContext)
+	return withCtx, ok
+}
+
+// verify runs [verifyFunc] and performs the cache bookkeeping shared by
+// [Verify] and [VerifyWithContext]. [parked] is true if the block is verified
+// again after being parked by [State.parkPending].
+func (bw *BlockWrapper) verify(
+	ctx context.Context,
+	withContext bool,
+	parked bool,
+	verifyFunc func(context.Context) error,
+) (err error) {
+	spanName := verifySpan
+	if withContext {
+		spanName = verifyWithContextSpan
+	}
+	ctx, end := bw.state.startSpan(ctx, spanName, bw)
+	defer func() {
+		end(err)
+	}()
+
+	blkID := bw.key()
+	bw.state.lock.RLock()
+	closed := bw.state.closed
+	verifiedBlk, verified := bw.state.verifiedBlocks.Get(blkID)
+	// Without a decided cache, the last accepted block is only known to be
+	// decided through [lastAcceptedBlock].
+	lastAccepted := bw.state.isLastAccepted(blkID)
+	// Parked blocks aren't added to the processing blocks when verified again.
+	tooManyProcessing := !parked && bw.state.tooManyProcessing()
+	missingParent := bw.state.missingParent(bw) ||
+		bw.state.readOnly && !bw.state.isLastAccepted(bw.Parent())
+	bw.state.lock.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	if verified {
+		// A duplicate wrapper is only merged into the verified one if it
+		// encodes the same block.
+		return checkBytes(blkID, verifiedBlk, bw.Bytes())
+	}
+	if lastAccepted {
+		return fmt.Errorf("%w: %s", errBlockAlreadyDecided, blkID)
+	}
+	if tooManyProcessing {
+		return errTooManyProcessing
+	}
+	if missingParent {
+		return fmt.Errorf("%w: %s", errMissingParent, bw.Parent())
+	}
+	if _, ok := bw.state.decidedBlocks.Get(blkID); ok {
+		return fmt.Errorf("%w: %s", errBlockAlreadyDecided, blkID)
+	}
+	if err, ok := bw.state.failedVerifications.Get(blkID); ok {
+		return err
+	}
+	if err := bw.state.checkHeight(bw); err != nil {
+		return err
+	}
+
+	if bw.state.preVerify != nil {
+		if err := bw.state.preVerify(ctx, bw.Block); err != nil {
+			return err
+		}
+	}
+
+	attempted, err := bw.verifyUnderlying(ctx, withContext, verifyFunc)
+	if !attempted {
+		return err
+	}
+	if err != nil {
+		// The error is wrapped so that it identifies the block, while
+		// remaining matchable with errors.Is and errors.As.
+		err = fmt.Errorf("verify block %s at height %d: %w", blkID, bw.Height(), err)
 		// Note: we cannot cache blocks failing verification in case
 		// the error is temporary and the block could become valid in
-		// the future.
+		// the future, unless the error is known to be permanent.
+		if bw.state.isPermanentVerifyError(err) {
+			bw.state.failedVerifications.Put(blkID, err)
+		}
+		if bw.state.isMissingParentError(err) {
+			bw.state.parkPending(bw, func(ctx context.Context) error {
+				return bw.verify(ctx, withContext, true, verifyFunc)
+			})
+		}
 		return err
 	}
 
-	blkID := bw.ID()
+	// The caller may have abandoned the verification, in which case the
+	// block must not be added to consensus.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// In read-only mode, the block is not added to the verified blocks. It is
+	// only accepted once reported accepted by the feed of accepted blocks.
+	if bw.state.readOnly {
+		return bw.state.markReadOnlyVerified(bw)
+	}
+
+	// Consensus saw the verification of a parked block fail, so the block
+	// must not be processing. It is cached as unverified for consensus to
+	// verify it again, which its parked children may now also pass.
+	if parked {
+		bw.state.unverifiedBlocks.Put(blkID, bw)
+		bw.state.retryPending(ctx, blkID)
+		return nil
+	}
+
+	parent, parentDecided := bw.state.decidedParent(bw)
+	if err := bw.markVerified(parent, parentDecided); err != nil {
+		return err
+	}
+	bw.state.retryPending(ctx, blkID)
+	return nil
+}
+
+// markVerified adds the block to the verified blocks once it passed
+// verification, pinning [parent] if the parent of the block is [decided].
+func (bw *BlockWrapper) markVerified(parent decidedBlock, decided bool) error {
+	blkID := bw.key()
+	bw.state.lock.Lock()
+	defer bw.state.lock.Unlock()
+
+	// The state may have been closed while the block was being verified.
+	if bw.state.closed {
+		return ErrClosed
+	}
+	// Another wrapper of the block may have been verified in the meantime, in
+	// which case it is kept.
+	if verifiedBlk, ok := bw.state.verifiedBlocks.Get(blkID); ok {
+		return checkBytes(blkID, verifiedBlk, bw.Bytes())
+	}
+	// Concurrent verifications may have reached the limit in the meantime.
+	if bw.state.tooManyProcessing() {
+		return errTooManyProcessing
+	}
+	// The parent may have been decided in the meantime.
+	if bw.state.missingParent(bw) {
+		return fmt.Errorf("%w: %s", errMissingParent, bw.Parent())
+	}
+
 	bw.state.unverifiedBlocks.Evict(blkID)
-	bw.state.verifiedBlocks[blkID] = bw
+	bw.state.missingBlocks.Evict(blkID)
+	bw.verifiedAt = time.Now()
+	bw.state.verifiedBlocks.Put(blkID, bw)
+	bw.state.pinParent(bw, parent, decided)
+	bw.state.metrics.setProcessing(bw.state.verifiedBlocks.Len())
 	return nil
 }
 
-// VerifyWithContext verifies the underlying block with context
+// VerifyWithContext verifies the underlying block with context, performing the
+// same cache bookkeeping as [Verify]. If the underlying block does not
+// implement block.WithVerifyContext, or should not be verified with a context,
+// it falls back to [Verify], unless [Config.StrictVerifyContext] is set, in
+// which case blocks not implementing block.WithVerifyContext are rejected.
+//
+// [blockCtx] is first checked by [Config.ValidateContext], if set. If [bw]
+// was returned by [State.WrapStrictContextBlock], the underlying block is
+// always verified with [blockCtx].
 func (bw *BlockWrapper) VerifyWithContext(ctx context.Context, blockCtx *block.Context) error {
+	if bw.state.validateContext != nil {
+		if err := bw.state.validateContext(blockCtx); err != nil {
+			return err
+		}
+	}
+
+	if withCtx, ok := bw.strictContextBlock(); ok {
+		return bw.verify(ctx, true, false, func(ctx context.Context) error {
+			return withCtx.VerifyWithContext(ctx, blockCtx)
+		})
+	}
+
 	// If the embedded block supports context verification, use it
-	if withCtx, ok := bw.Block.(block.WithVerifyContext); ok {
-		shouldVerify, err := withCtx.ShouldVerifyWithContext(ctx)
+	withCtx, ok := bw.Block.(block.WithVerifyContext)
+	if ok {
+		shouldVerify, err := bw.ShouldVerifyWithContext(ctx)
 		if err != nil {
 			return err
 		}
 		if shouldVerify {
-			return withCtx.VerifyWithContext(ctx, blockCtx)
+			return bw.verify(ctx, true, false, func(ctx context.Context) error {
+				return withCtx.VerifyWithContext(ctx, blockCtx)
+			})
 		}
 	}
 	// Otherwise fall back to regular Verify
+	if !ok {
+		if bw.state.strictVerifyContext {
+			return errExpectedBlockWithVerifyContext
+		}
+		bw.state.metrics.verifyContextFallback()
+	}
 	return bw.Verify(ctx)
 }
 
+// shouldVerifyWithContextResult is the cached result of
+// [BlockWrapper.ShouldVerifyWithContext] for the wrapper [bw].
+type shouldVerifyWithContextResult struct {
+	bw           *BlockWrapper
+	shouldVerify bool
+	err          error
+}
+
 // ShouldVerifyWithContext checks if the underlying block should be verified
 // with a block context. If the underlying block does not implement the
 // block.WithVerifyContext interface, returns false without an error. Does not
 // touch any block cache.
+//
+// The result of the underlying block is cached until the block is decided.
+// Wrappers returned by [State.WrapStrictContextBlock] always return true.
 func (bw *BlockWrapper) ShouldVerifyWithContext(ctx context.Context) (bool, error) {
+	if _, ok := bw.strictContextBlock(); ok {
+		return true, nil
+	}
 	blkWithCtx, ok := bw.Block.(block.WithVerifyContext)
 	if !ok {
 		return false, nil
 	}
-	return blkWithCtx.ShouldVerifyWithContext(ctx)
+
+	blkID := bw.key()
+	if result, ok := bw.state.shouldVerifyWithContext.Get(blkID); ok && result.bw == bw {
+		return result.shouldVerify, result.err
+	}
+
+	shouldVerify, err := blkWithCtx.ShouldVerifyWithContext(ctx)
+	bw.state.shouldVerifyWithContext.Put(blkID, shouldVerifyWithContextResult{
+		bw:           bw,
+		shouldVerify: shouldVerify,
+		err:          err,
+	})
+	return shouldVerify, err
 }
 
 // Accept accepts the underlying block, removes it from verifiedBlocks, caches it as a decided
-// block, and updates the last accepted block.
-func (bw *BlockWrapper) Accept(ctx context.Context) error {
-	blkID := bw.ID()
-	delete(bw.state.verifiedBlocks, blkID)
-	bw.state.decidedBlocks.Put(blkID, bw)
+// block, indexes it by height, and updates the last accepted block. Once the
+// underlying block is accepted, it is written to [Config.DecidedStore].
+//
+// The caches are not modified if the underlying block fails to be accepted.
+// As the caches are updated after the underlying block is accepted, the last
+// accepted block is not yet updated while the underlying Accept runs.
+//
+// Accepting a block that was already accepted logs a warning and does nothing.
+// Accepting a block that was already rejected returns an error.
+func (bw *BlockWrapper) Accept(ctx context.Context) (err error) {
+	ctx, end := bw.state.startSpan(ctx, acceptSpan, bw)
+	defer func() {
+		end(err)
+	}()
+
+	if bw.state.isClosed() {
+		return ErrClosed
+	}
+
+	blkID := bw.key()
+	if accepted, decided := bw.state.decision(blkID); decided {
+		if !accepted {
+			return fmt.Errorf("%w: accepting rejected block %s", errConflictingDecision, blkID)
+		}
+		bw.state.log.Warn("ignoring repeated accept",
+			"blkID", blkID,
+			"height", bw.Height(),
+		)
+		return nil
+	}
+
+	// The caches are only updated once the underlying block is accepted, so
+	// that a failed Accept leaves the block processing.
+	if err := bw.state.decide(ctx, blkID, bw.Block.Accept); err != nil {
+		return err
+	}
+
+	// The decided blocks are updated before [verifiedBlocks] so that the
+	// block is always cached. This must not hold [bw.state.lock], as the cache
+	// may call [Config.OnEvict].
+	bw.state.decidedBlocks.Put(blkID, decidedBlock{
+		BlockWrapper: bw,
+		accepted:     true,
+	})
+
+	bw.state.lock.Lock()
+	processingTime := bw.state.removeVerified(blkID)
+	bw.state.missingBlocks.Evict(blkID)
+	prevTip := bw.state.lastAcceptedBlock
 	bw.state.lastAcceptedBlock = bw
+	bw.state.acceptedHeights.Put(bw.Height(), blkID)
+	bw.state.metrics.setLastAccepted(bw)
+	bw.state.evictOrphans()
+	// The other blocks verified in read-only mode are no longer children of
+	// the last accepted block, so they can't be accepted.
+	clear(bw.state.readOnlyVerified)
+	bw.state.lock.Unlock()
+
+	if prevTip != nil && bw.Parent() != prevTip.key() {
+		bw.state.observeReorg(prevTip, bw)
+	}
+
+	bw.accepted(ctx, processingTime)
+	return nil
+}
 
-	return bw.Block.Accept(ctx)
+// accepted performs the bookkeeping that follows the acceptance of the block,
+// once the block is cached as decided and is no longer processing.
+// [processingTime] is the time the block spent processing.
+func (bw *BlockWrapper) accepted(ctx context.Context, processingTime time.Duration) {
+	blkID := bw.key()
+	bw.decided()
+	bw.state.shouldVerifyWithContext.Evict(blkID)
+	bw.state.indexChild(bw)
+	bw.state.storeAcceptedBlock(bw)
+	bw.state.acceptedNotifier.notify(bw.ID())
+	bw.state.retryPending(ctx, blkID)
+	bw.state.log.Info("accepted block",
+		"blkID", blkID,
+		"height", bw.Height(),
+		"parentID", bw.Parent(),
+		"processingTime", processingTime,
+	)
+	if bw.state.onAccept != nil {
+		if err := bw.state.onAccept(ctx, bw); err != nil {
+			bw.state.log.Error("accept callback failed",
+				"blkID", blkID,
+				"height", bw.Height(),
+				"error", err,
+			)
+		}
+	}
 }
 
 // Reject rejects the underlying block, removes it from processing blocks, and caches it as a
-// decided block.
-func (bw *BlockWrapper) Reject(ctx context.Context) error {
-	blkID := bw.ID()
-	delete(bw.state.verifiedBlocks, blkID)
-	bw.state.decidedBlocks.Put(blkID, bw)
-	return bw.Block.Reject(ctx)
+// decided block. If [Config.CascadeReject] is set, the processing descendants
+// of the block are evicted as well.
+//
+// The caches are not modified if the underlying block fails to be rejected.
+//
+// Rejecting a block that was already rejected logs a warning and does nothing.
+// Rejecting a block that was already accepted returns an error.
+func (bw *BlockWrapper) Reject(ctx context.Context) (err error) {
+	ctx, end := bw.state.startSpan(ctx, rejectSpan, bw)
+	defer func() {
+		end(err)
+	}()
+
+	if bw.state.isClosed() {
+		return ErrClosed
+	}
+
+	blkID := bw.key()
+	if accepted, decided := bw.state.decision(blkID); decided {
+		if accepted {
+			return fmt.Errorf("%w: rejecting accepted block %s", errConflictingDecision, blkID)
+		}
+		bw.state.log.Warn("ignoring repeated reject",
+			"blkID", blkID,
+			"height", bw.Height(),
+		)
+		return nil
+	}
+
+	// See Accept for why the caches are updated after the underlying block.
+	if err := bw.state.decide(ctx, blkID, bw.Block.Reject); err != nil {
+		return err
+	}
+
+	// See Accept for why the decided blocks are updated first.
+	if !bw.state.disableRejectedCache {
+		bw.state.decidedBlocks.Put(blkID, decidedBlock{
+			BlockWrapper: bw,
+		})
+	}
+
+	bw.state.lock.Lock()
+	processingTime := bw.state.removeVerified(blkID)
+	if bw.state.cascadeReject {
+		bw.state.evictDescendants(blkID)
+		bw.state.metrics.setProcessing(bw.state.verifiedBlocks.Len())
+	}
+	bw.state.lock.Unlock()
+
+	bw.state.options.Evict(blkID)
+	bw.state.optionsN.Evict(blkID)
+	bw.state.shouldVerifyWithContext.Evict(blkID)
+	bw.state.indexChild(bw)
+	bw.decided()
+	bw.state.log.Debug("rejected block",
+		"blkID", blkID,
+		"height", bw.Height(),
+		"parentID", bw.Parent(),
+		"processingTime", processingTime,
+	)
+	return nil
+}
+
+// decide calls [f], which accepts or rejects the underlying block with ID
+// [blkID]. If [ctx] has no deadline, [f] is bounded by
+// [Config.DecisionTimeout].
+func (s *State) decide(ctx context.Context, blkID ids.ID, f func(context.Context) error) error {
+	if _, ok := ctx.Deadline(); ok || s.decisionTimeout == 0 {
+		return f(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.decisionTimeout)
+	defer cancel()
+
+	err := f(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: block %s after %s: %w", ErrDecisionTimeout, blkID, s.decisionTimeout, err)
+	}
+	return err
+}
+
+// verifyUnderlying verifies the underlying block with [verifyFunc], retrying
+// temporary failures as configured by [Config.MaxVerifyRetries]. It returns
+// false if the underlying block couldn't be verified because no verification
+// slot was acquired, and otherwise the result of the last attempt.
+func (bw *BlockWrapper) verifyUnderlying(
+	ctx context.Context,
+	withContext bool,
+	verifyFunc func(context.Context) error,
+) (bool, error) {
+	var (
+		backoff   = bw.state.verifyRetryBackoff
+		attempted bool
+		lastErr   error
+	)
+	for retries := 0; ; retries++ {
+		// The slot is released between attempts, so that waiting for a retry
+		// doesn't hold back the verification of other blocks.
+		if err := bw.state.acquireVerifySlot(ctx); err != nil {
+			if attempted {
+				return true, lastErr
+			}
+			return false, err
+		}
+		stopTimer := bw.state.metrics.startVerify(withContext)
+		err := verifyFunc(bw.state.withParentState(ctx, bw))
+		stopTimer()
+		bw.state.releaseVerifySlot()
+		if err == nil || !bw.state.shouldRetryVerify(err, retries) {
+			return true, err
+		}
+		attempted, lastErr = true, err
+
+		bw.state.log.Debug("retrying block verification",
+			"blkID", bw.key(),
+			"height", bw.Height(),
+			"retry", retries+1,
+			"backoff", backoff,
+			"error", err,
+		)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return true, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// Options returns the options of the underlying block if it is an
+// [OracleBlock] or an [OracleBlockWithContext], and [ErrNotOracle] otherwise.
+//
+// The options are resolved from the underlying block once and then served from
+// the options cache. Each option is wrapped and added to the appropriate block
+// cache so that consensus can later verify it without loading it again.
+func (bw *BlockWrapper) Options(ctx context.Context) ([2]block.Block, error) {
+	options, err := bw.options(ctx)
+	if err != nil {
+		return [2]block.Block{}, err
+	}
+	return [2]block.Block{options[0], options[1]}, nil
+}
+
+// OptionsWithContext is the same as [Options], but returns the options as
+// [ContextBlock]s. The wrapped options verify the underlying options with the
+// provided block context if they support it.
+func (bw *BlockWrapper) OptionsWithContext(ctx context.Context) ([2]ContextBlock, error) {
+	options, err := bw.options(ctx)
+	if err != nil {
+		return [2]ContextBlock{}, err
+	}
+	return [2]ContextBlock{options[0], options[1]}, nil
+}
+
+func (bw *BlockWrapper) options(ctx context.Context) ([2]*BlockWrapper, error) {
+	_, isOracle := bw.Block.(OracleBlock)
+	_, isOracleWithContext := bw.Block.(OracleBlockWithContext)
+	if !isOracle && !isOracleWithContext {
+		return [2]*BlockWrapper{}, ErrNotOracle
+	}
+
+	blkID := bw.key()
+	if options, ok := bw.state.options.Get(blkID); ok {
+		return options, nil
+	}
+
+	blkOptions, err := bw.underlyingOptions(ctx)
+	if err != nil {
+		return [2]*BlockWrapper{}, err
+	}
+	var options [2]*BlockWrapper
+	for i, option := range blkOptions {
+		options[i] = bw.state.WrapBlock(option)
+	}
+	if bw.state.shareOptionParentState {
+		siblings := &optionSiblings{parentID: blkID}
+		for _, option := range options {
+			// An option that was already resolved keeps its siblings.
+			option.siblings.CompareAndSwap(nil, siblings)
+		}
+	}
+	bw.state.options.Put(blkID, options)
+	return options, nil
+}
+
+// OptionsN returns the options of the underlying block if it is an
+// [OracleBlockN], [OracleBlock] or [OracleBlockWithContext], and [ErrNotOracle]
+// otherwise. Options are wrapped and cached in the same way as by [Options].
+func (bw *BlockWrapper) OptionsN(ctx context.Context) ([]block.Block, error) {
+	oracleBlk, ok := bw.Block.(OracleBlockN)
+	if !ok {
+		options, err := bw.options(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return []block.Block{options[0], options[1]}, nil
+	}
+
+	blkID := bw.key()
+	if options, ok := bw.state.optionsN.Get(blkID); ok {
+		return options, nil
+	}
+
+	blkOptions, err := oracleBlk.OptionsN(ctx)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]block.Block, len(blkOptions))
+	for i, option := range blkOptions {
+		options[i] = bw.state.WrapBlock(option)
+	}
+	bw.state.optionsN.Put(blkID, options)
+	return options, nil
+}
+
+// underlyingOptions returns the options of the underlying oracle block,
+// preferring [OracleBlockWithContext] over [OracleBlock].
+func (bw *BlockWrapper) underlyingOptions(ctx context.Context) ([2]block.Block, error) {
+	if oracleBlk, ok := bw.Block.(OracleBlockWithContext); ok {
+		options, err := oracleBlk.OptionsWithContext(ctx)
+		if err != nil {
+			return [2]block.Block{}, err
+		}
+		return [2]block.Block{options[0], options[1]}, nil
+	}
+	return bw.Block.(OracleBlock).Options(ctx)
 }
 
 // OracleBlock is a block that can have multiple valid children, and one needs
@@ -100,3 +708,79 @@ type OracleBlock interface {
 	// Options returns the block options that may be chosen by the oracle.
 	Options(context.Context) ([2]block.Block, error)
 }
+
+// OracleBlockN is an oracle block that may have any number of options.
+type OracleBlockN interface {
+	block.Block
+
+	// OptionsN returns the block options that may be chosen by the oracle.
+	OptionsN(context.Context) ([]block.Block, error)
+}
+
+// ContextBlock is a block that supports verification with a block context.
+type ContextBlock interface {
+	block.Block
+	block.WithVerifyContext
+}
+
+// OracleBlockWithContext is an oracle block whose options support
+// verification with a block context.
+type OracleBlockWithContext interface {
+	block.Block
+
+	// OptionsWithContext returns the block options that may be chosen by the
+	// oracle.
+	OptionsWithContext(context.Context) ([2]ContextBlock, error)
+}
+
+// StateSummary returns the state summary of the underlying block if it is a
+// [StateSummaryProvider], and [ErrNoStateSummary] otherwise.
+func (bw *BlockWrapper) StateSummary() ([]byte, error) {
+	provider, ok := bw.Block.(StateSummaryProvider)
+	if !ok {
+		return nil, ErrNoStateSummary
+	}
+	return provider.StateSummary()
+}
+
+// VerifyAgainst verifies the underlying block against the state of [parent]
+// rather than the state the underlying block would otherwise assume, such as
+// the preferred tip. The cache bookkeeping is the same as [Verify].
+//
+// The underlying block must implement [AncestorVerifier], and [parent] must be
+// the wrapper of the block's parent. Blocks must be verified in order, each
+// after its parent was verified or accepted, and the parent must not have been
+// rejected.
+func (bw *BlockWrapper) VerifyAgainst(ctx context.Context, parent *BlockWrapper) error {
+	verifier, ok := bw.Block.(AncestorVerifier)
+	if !ok {
+		return errExpectedAncestorVerifier
+	}
+	if parentID := parent.ID(); parentID != bw.Parent() {
+		return fmt.Errorf("%w: expected %s but got %s", errUnexpectedParent, bw.Parent(), parentID)
+	}
+	if accepted, decided := bw.state.decision(parent.key()); decided && !accepted {
+		return fmt.Errorf("%w: %s", errRejectedParent, parent.ID())
+	}
+	return bw.verify(ctx, false, false, func(ctx context.Context) error {
+		return verifier.VerifyAgainst(ctx, parent.Block)
+	})
+}
+
+// AncestorVerifier is a block that can be verified against the state of a
+// specific parent, which is required to verify blocks out of the order of the
+// preferred chain, such as during bootstrapping.
+type AncestorVerifier interface {
+	block.Block
+
+	// VerifyAgainst verifies the block against the state resulting from
+	// [parent], which is the block's parent. The VM must retain the state of
+	// [parent] until the block is decided.
+	VerifyAgainst(ctx context.Context, parent block.Block) error
+}
+
+// StateSummaryProvider is a block that carries state sync summary data.
+type StateSummaryProvider interface {
+	// StateSummary returns the bytes of the state summary of the block.
+	StateSummary() ([]byte, error)
+}
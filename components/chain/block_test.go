@@ -0,0 +1,1456 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/core/choices"
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/log"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var _ OracleBlock = (*testOracleBlock)(nil)
+
+type testOracleBlock struct {
+	*chaintest.Block
+
+	options      [2]block.Block
+	optionsCalls int
+}
+
+func (b *testOracleBlock) Options(context.Context) ([2]block.Block, error) {
+	b.optionsCalls++
+	return b.options, nil
+}
+
+func TestBlockWrapperOptionsCached(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	oracle := &testOracleBlock{Block: chaintest.NewBlock(genesis)}
+	option0 := chaintest.NewBlock(oracle.Block)
+	option1 := chaintest.NewBlock(oracle.Block)
+	oracle.options = [2]block.Block{option0, option1}
+	blks := chaintest.Blocks{
+		oracle.ID(): oracle.Block,
+	}
+	config := newTestConfig(genesis, blks)
+	config.GetBlock = func(ctx context.Context, blkID ids.ID) (block.Block, error) {
+		if blkID == oracle.ID() {
+			return oracle, nil
+		}
+		return blks.GetBlock(ctx, blkID)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, oracle.ID())
+	require.NoError(err)
+	oracleBlk, ok := blk.(OracleBlock)
+	require.True(ok)
+
+	options, err := oracleBlk.Options(ctx)
+	require.NoError(err)
+	require.Equal(1, oracle.optionsCalls)
+
+	// Both options are wrapped and available to consensus from the cache.
+	for i, option := range options {
+		require.IsType(&BlockWrapper{}, option)
+		require.Equal(oracle.options[i].ID(), option.ID())
+
+		cachedOption, err := state.GetBlock(ctx, option.ID())
+		require.NoError(err)
+		require.Same(option, cachedOption)
+	}
+
+	// Repeated calls are served from the options cache.
+	options2, err := oracleBlk.Options(ctx)
+	require.NoError(err)
+	require.Equal(options, options2)
+	require.Equal(1, oracle.optionsCalls)
+
+	// Rejecting the oracle block invalidates its options.
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Reject(ctx))
+	_, ok = state.options.Get(oracle.ID())
+	require.False(ok)
+}
+
+func TestBlockWrapperOptionsNotOracle(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	_, err = state.LastAcceptedBlock().Options(context.Background())
+	require.ErrorIs(err, ErrNotOracle)
+}
+
+func TestBlockWrapperVerifyAlreadyVerified(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+
+	// The underlying block is not verified again.
+	child.VerifyV = errTestVerify
+	require.NoError(blk.Verify(ctx))
+
+	// A different wrapper reusing the ID is discarded in favor of the
+	// verified one.
+	duplicate := &BlockWrapper{
+		Block: child,
+		state: state,
+	}
+	require.NoError(duplicate.Verify(ctx))
+	require.Equal([]block.Block{blk}, state.ProcessingBlocks())
+}
+
+func TestBlockWrapperCascadeReject(t *testing.T) {
+	tests := []struct {
+		name          string
+		cascadeReject bool
+	}{
+		{
+			name:          "cascade",
+			cascadeReject: true,
+		},
+		{
+			name:          "no cascade",
+			cascadeReject: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.CascadeReject = test.cascadeReject
+			state, err := NewState(config)
+			require.NoError(err)
+
+			// genesis -> rejected -> child -> grandchild
+			//         \> sibling
+			ctx := context.Background()
+			rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+			child := state.WrapBlock(chaintest.NewBlock(rejected.Block.(*chaintest.Block)))
+			grandchild := state.WrapBlock(chaintest.NewBlock(child.Block.(*chaintest.Block)))
+			sibling := state.WrapBlock(chaintest.NewBlock(genesis))
+			for _, bw := range []*BlockWrapper{rejected, child, grandchild, sibling} {
+				require.NoError(bw.Verify(ctx))
+			}
+
+			require.NoError(rejected.Reject(ctx))
+			require.False(state.IsProcessing(rejected.ID()))
+			require.Equal(!test.cascadeReject, state.IsProcessing(child.ID()))
+			require.Equal(!test.cascadeReject, state.IsProcessing(grandchild.ID()))
+			require.True(state.IsProcessing(sibling.ID()))
+		})
+	}
+}
+
+func TestBlockWrapperAutoOrphanCleanup(t *testing.T) {
+	tests := []struct {
+		name              string
+		autoOrphanCleanup bool
+	}{
+		{
+			name:              "cleanup",
+			autoOrphanCleanup: true,
+		},
+		{
+			name:              "no cleanup",
+			autoOrphanCleanup: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.AutoOrphanCleanup = test.autoOrphanCleanup
+			state, err := NewState(config)
+			require.NoError(err)
+
+			// genesis -> accepted -> child -> grandchild
+			//         \> orphan -> orphanChild -> orphanGrandchild
+			ctx := context.Background()
+			accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+			child := state.WrapBlock(chaintest.NewBlock(accepted.Block.(*chaintest.Block)))
+			grandchild := state.WrapBlock(chaintest.NewBlock(child.Block.(*chaintest.Block)))
+			orphan := state.WrapBlock(chaintest.NewBlock(genesis))
+			orphanChild := state.WrapBlock(chaintest.NewBlock(orphan.Block.(*chaintest.Block)))
+			orphanGrandchild := state.WrapBlock(chaintest.NewBlock(orphanChild.Block.(*chaintest.Block)))
+			orphans := []*BlockWrapper{orphan, orphanChild, orphanGrandchild}
+			for _, bw := range append([]*BlockWrapper{accepted, child, grandchild}, orphans...) {
+				require.NoError(bw.Verify(ctx))
+			}
+
+			require.NoError(accepted.Accept(ctx))
+			require.True(state.IsProcessing(child.ID()))
+			require.True(state.IsProcessing(grandchild.ID()))
+			for _, bw := range orphans {
+				require.Equal(!test.autoOrphanCleanup, state.IsProcessing(bw.ID()))
+				// The orphans weren't rejected.
+				require.Equal(choices.Processing, bw.Block.(*chaintest.Block).StatusV)
+			}
+
+			// Consensus is still able to reject the orphans.
+			for _, bw := range orphans {
+				require.NoError(bw.Reject(ctx))
+				status, _ := state.Status(bw.ID())
+				require.Equal(StatusRejected, status)
+			}
+			require.True(state.IsProcessing(child.ID()))
+		})
+	}
+}
+
+var _ block.WithVerifyContext = (*testContextBlock)(nil)
+
+type testContextBlock struct {
+	*chaintest.Block
+
+	shouldVerifyWithContext      bool
+	shouldVerifyWithContextCalls int
+	verifiedContext              *block.Context
+}
+
+func (b *testContextBlock) ShouldVerifyWithContext(context.Context) (bool, error) {
+	b.shouldVerifyWithContextCalls++
+	return b.shouldVerifyWithContext, nil
+}
+
+func (b *testContextBlock) VerifyWithContext(_ context.Context, blockCtx *block.Context) error {
+	b.verifiedContext = blockCtx
+	return b.VerifyV
+}
+
+func TestBlockWrapperVerifyWithContext(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blockCtx := &block.Context{PChainHeight: 1}
+	withCtx := &testContextBlock{
+		Block:                   chaintest.NewBlock(genesis),
+		shouldVerifyWithContext: true,
+	}
+	bw := state.WrapBlock(withCtx)
+	require.NoError(bw.VerifyWithContext(ctx, blockCtx))
+	require.Equal(blockCtx, withCtx.verifiedContext)
+	require.True(state.IsProcessing(bw.ID()))
+
+	// Blocks without context support fall back to Verify.
+	withoutCtx := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(withoutCtx.VerifyWithContext(ctx, blockCtx))
+	require.True(state.IsProcessing(withoutCtx.ID()))
+}
+
+func TestBlockWrapperStrictVerifyContext(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.StrictVerifyContext = true
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blockCtx := &block.Context{PChainHeight: 1}
+	withoutCtx := state.WrapBlock(chaintest.NewBlock(genesis))
+	err = withoutCtx.VerifyWithContext(ctx, blockCtx)
+	require.ErrorIs(err, errExpectedBlockWithVerifyContext)
+	require.False(state.IsProcessing(withoutCtx.ID()))
+
+	// Blocks that support context verification but don't require it still
+	// fall back to Verify.
+	optionalCtx := state.WrapBlock(&testContextBlock{
+		Block: chaintest.NewBlock(genesis),
+	})
+	require.NoError(optionalCtx.VerifyWithContext(ctx, blockCtx))
+	require.True(state.IsProcessing(optionalCtx.ID()))
+}
+
+func TestWrapStrictContextBlock(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	// The underlying block never asks to be verified with a context, yet it
+	// always is.
+	ctx := context.Background()
+	withCtx := &testContextBlock{Block: chaintest.NewBlock(genesis)}
+	bw := state.WrapStrictContextBlock(withCtx)
+	require.Same(bw, state.WrapBlock(withCtx))
+	shouldVerify, err := bw.ShouldVerifyWithContext(ctx)
+	require.NoError(err)
+	require.True(shouldVerify)
+
+	blockCtx := &block.Context{PChainHeight: 1}
+	require.NoError(bw.VerifyWithContext(ctx, blockCtx))
+	require.Equal(blockCtx, withCtx.verifiedContext)
+	require.Zero(withCtx.shouldVerifyWithContextCalls)
+	require.True(state.IsProcessing(withCtx.ID()))
+
+	// Verify routes through VerifyWithContext as well.
+	other := &testContextBlock{
+		Block:           chaintest.NewBlock(genesis),
+		verifiedContext: blockCtx,
+	}
+	otherBw := state.WrapStrictContextBlock(other)
+	require.NoError(otherBw.Verify(ctx))
+	require.Nil(other.verifiedContext)
+	require.True(state.IsProcessing(other.ID()))
+
+	// Wrappers of blocks that can't be verified with a context are refused.
+	plain := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.Panics(func() {
+		state.WrapStrictContextBlock(plain)
+	})
+}
+
+var errTestStaleContext = errors.New("stale context")
+
+func TestBlockWrapperValidateContext(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.ValidateContext = func(blockCtx *block.Context) error {
+		if blockCtx.PChainHeight < 10 {
+			return errTestStaleContext
+		}
+		return nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	withCtx := &testContextBlock{
+		Block:                   chaintest.NewBlock(genesis),
+		shouldVerifyWithContext: true,
+	}
+	bw := state.WrapBlock(withCtx)
+	err = bw.VerifyWithContext(ctx, &block.Context{PChainHeight: 1})
+	require.ErrorIs(err, errTestStaleContext)
+	require.Zero(withCtx.shouldVerifyWithContextCalls)
+	require.Nil(withCtx.verifiedContext)
+	require.Equal(CacheLocationUnverified, bw.CacheLocation())
+
+	blockCtx := &block.Context{PChainHeight: 10}
+	require.NoError(bw.VerifyWithContext(ctx, blockCtx))
+	require.Equal(blockCtx, withCtx.verifiedContext)
+	require.True(state.IsProcessing(withCtx.ID()))
+}
+
+func TestBlockWrapperPreVerify(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	rejected := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.PreVerify = func(_ context.Context, blk block.Block) error {
+		if blk.ID() == rejected.ID() {
+			return errTestVerify
+		}
+		return nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	rejectedBlk := state.WrapBlock(rejected)
+	require.ErrorIs(rejectedBlk.Verify(ctx), errTestVerify)
+	require.False(state.IsProcessing(rejected.ID()))
+	status, _ := state.Status(rejected.ID())
+	require.Equal(StatusUnverified, status)
+
+	allowed := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(allowed.Verify(ctx))
+	require.True(state.IsProcessing(allowed.ID()))
+}
+
+func TestBlockWrapperShouldVerifyWithContextCached(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	withCtx := &testContextBlock{
+		Block:                   chaintest.NewBlock(genesis),
+		shouldVerifyWithContext: true,
+	}
+	bw := state.WrapBlock(withCtx)
+	for range 3 {
+		shouldVerify, err := bw.ShouldVerifyWithContext(ctx)
+		require.NoError(err)
+		require.True(shouldVerify)
+	}
+	require.NoError(bw.VerifyWithContext(ctx, &block.Context{}))
+	require.Equal(1, withCtx.shouldVerifyWithContextCalls)
+
+	// The cached result is dropped once the block is decided.
+	require.NoError(bw.Accept(ctx))
+	_, ok := state.shouldVerifyWithContext.Get(bw.ID())
+	require.False(ok)
+}
+
+// allocatingContextBlock is a block whose ShouldVerifyWithContext allocates,
+// as would be the case for a block that needs to decode its contents.
+type allocatingContextBlock struct {
+	*chaintest.Block
+
+	decoded []byte
+}
+
+func (b *allocatingContextBlock) ShouldVerifyWithContext(context.Context) (bool, error) {
+	b.decoded = append([]byte(nil), b.Bytes()...)
+	return len(b.decoded) > 0, nil
+}
+
+func (*allocatingContextBlock) VerifyWithContext(context.Context, *block.Context) error {
+	return nil
+}
+
+func BenchmarkShouldVerifyWithContext(b *testing.B) {
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(b, err)
+
+	ctx := context.Background()
+	blk := &allocatingContextBlock{Block: chaintest.NewBlock(genesis)}
+	bw := state.WrapBlock(blk)
+
+	b.Run("underlying", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = blk.ShouldVerifyWithContext(ctx)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = bw.ShouldVerifyWithContext(ctx)
+		}
+	})
+}
+
+func TestBlockWrapperVerifyAlreadyDecided(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+
+	// The underlying block must not be verified again.
+	accepted.Block.(*chaintest.Block).VerifyV = errTestVerify
+	require.ErrorIs(accepted.Verify(ctx), errBlockAlreadyDecided)
+	require.ErrorIs(accepted.VerifyWithContext(ctx, &block.Context{}), errBlockAlreadyDecided)
+	require.False(state.IsProcessing(accepted.ID()))
+
+	require.ErrorIs(rejected.Verify(ctx), errBlockAlreadyDecided)
+}
+
+func TestBuildOracleOptions(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	oracle := &testOracleBlock{Block: chaintest.NewBlock(genesis)}
+	option0 := chaintest.NewBlock(oracle.Block)
+	option1 := chaintest.NewBlock(oracle.Block)
+	oracle.options = [2]block.Block{option0, option1}
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	options, err := state.BuildOracleOptions(ctx, oracle)
+	require.NoError(err)
+	for i, option := range options {
+		require.Equal(oracle.options[i], option.Block)
+
+		cachedOption, ok := state.unverifiedBlocks.Get(option.ID())
+		require.True(ok)
+		require.Same(option, cachedOption)
+	}
+
+	// The options are shared with the wrapper of the oracle block.
+	blkOptions, err := state.WrapBlock(oracle).Options(ctx)
+	require.NoError(err)
+	require.Equal([2]block.Block{options[0], options[1]}, blkOptions)
+	require.Equal(1, oracle.optionsCalls)
+}
+
+func TestBlockWrapperVerifyCancelled(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	blk := &blockingVerifyBlock{
+		Block:     chaintest.NewBlock(genesis),
+		verifying: make(chan struct{}),
+		unblock:   make(chan struct{}),
+	}
+	bw := state.WrapBlock(blk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	verifyErr := make(chan error, 1)
+	go func() {
+		verifyErr <- bw.Verify(ctx)
+	}()
+	<-blk.verifying
+
+	// The underlying block verifies successfully after the context is
+	// cancelled.
+	cancel()
+	close(blk.unblock)
+	require.ErrorIs(<-verifyErr, context.Canceled)
+	require.False(state.IsProcessing(bw.ID()))
+	status, _ := state.Status(bw.ID())
+	require.Equal(StatusUnverified, status)
+}
+
+func TestBlockWrapperMaxProcessing(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.MaxProcessing = 2
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	blk2 := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk1.Verify(ctx))
+	require.NoError(blk2.Verify(ctx))
+
+	// The underlying block isn't verified once the limit is reached.
+	blk3 := state.WrapBlock(chaintest.NewBlock(genesis))
+	blk3.Block.(*chaintest.Block).VerifyV = errTestVerify
+	require.ErrorIs(blk3.Verify(ctx), errTooManyProcessing)
+	require.False(state.IsProcessing(blk3.ID()))
+
+	// Blocks that are already processing are unaffected.
+	require.NoError(blk1.Verify(ctx))
+
+	// Deciding a block makes room for another.
+	require.NoError(blk1.Accept(ctx))
+	blk4 := state.WrapBlock(chaintest.NewBlock(blk1.Block.(*chaintest.Block)))
+	require.NoError(blk4.Verify(ctx))
+	require.True(state.IsProcessing(blk4.ID()))
+}
+
+func TestBlockWrapperVerifyErrorWrapped(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.PermanentVerifyErrors = []error{errTestVerify}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk := chaintest.NewBlock(genesis)
+	blk.VerifyV = errTestVerify
+	bw := state.WrapBlock(blk)
+
+	err = bw.Verify(ctx)
+	require.ErrorIs(err, errTestVerify)
+	require.ErrorContains(err, blk.ID().String())
+	require.ErrorContains(err, "height 1")
+
+	// Cached failures are returned wrapped.
+	cachedErr := bw.Verify(ctx)
+	require.ErrorIs(cachedErr, errTestVerify)
+	require.Equal(err.Error(), cachedErr.Error())
+}
+
+var errTestTemporary = errors.New("test temporary error")
+
+// flakyVerifyBlock fails its first [failures] verifications with
+// errTestTemporary.
+type flakyVerifyBlock struct {
+	*chaintest.Block
+
+	failures    int
+	verifyCalls int
+}
+
+func (b *flakyVerifyBlock) Verify(ctx context.Context) error {
+	b.verifyCalls++
+	if b.verifyCalls <= b.failures {
+		return errTestTemporary
+	}
+	return b.Block.Verify(ctx)
+}
+
+func TestBlockWrapperVerifyRetries(t *testing.T) {
+	isTemporary := func(err error) bool {
+		return errors.Is(err, errTestTemporary)
+	}
+	tests := []struct {
+		name                string
+		maxVerifyRetries    int
+		failures            int
+		timeout             time.Duration
+		backoff             time.Duration
+		expectedErr         error
+		expectedVerifyCalls int
+	}{
+		{
+			name:                "disabled",
+			failures:            1,
+			expectedErr:         errTestTemporary,
+			expectedVerifyCalls: 1,
+		},
+		{
+			name:                "succeeds after retries",
+			maxVerifyRetries:    3,
+			failures:            2,
+			expectedVerifyCalls: 3,
+		},
+		{
+			name:                "retries exhausted",
+			maxVerifyRetries:    2,
+			failures:            5,
+			expectedErr:         errTestTemporary,
+			expectedVerifyCalls: 3,
+		},
+		{
+			name:                "cancelled during backoff",
+			maxVerifyRetries:    3,
+			failures:            5,
+			timeout:             10 * time.Millisecond,
+			backoff:             time.Hour,
+			expectedErr:         errTestTemporary,
+			expectedVerifyCalls: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.IsTemporaryVerifyError = isTemporary
+			config.MaxVerifyRetries = test.maxVerifyRetries
+			config.VerifyRetryBackoff = time.Nanosecond
+			if test.backoff != 0 {
+				config.VerifyRetryBackoff = test.backoff
+			}
+			state, err := NewState(config)
+			require.NoError(err)
+
+			ctx := context.Background()
+			if test.timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, test.timeout)
+				defer cancel()
+			}
+			blk := &flakyVerifyBlock{
+				Block:    chaintest.NewBlock(genesis),
+				failures: test.failures,
+			}
+			bw := state.WrapBlock(blk)
+			require.ErrorIs(bw.Verify(ctx), test.expectedErr)
+			require.Equal(test.expectedVerifyCalls, blk.verifyCalls)
+			require.Equal(test.expectedErr == nil, state.IsProcessing(bw.ID()))
+			if test.expectedErr == nil {
+				return
+			}
+
+			// The failure isn't cached, so the block is verified again.
+			blk.failures = 0
+			require.NoError(bw.Verify(context.Background()))
+			require.Equal(test.expectedVerifyCalls+1, blk.verifyCalls)
+		})
+	}
+}
+
+func TestBlockWrapperMaxConcurrentVerify(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.MaxConcurrentVerify = 1
+	state, err := NewState(config)
+	require.NoError(err)
+
+	blocking := &blockingVerifyBlock{
+		Block:     chaintest.NewBlock(genesis),
+		verifying: make(chan struct{}),
+		unblock:   make(chan struct{}),
+	}
+	blockingBw := state.WrapBlock(blocking)
+	verifyErr := make(chan error, 1)
+	go func() {
+		verifyErr <- blockingBw.Verify(context.Background())
+	}()
+	<-blocking.verifying
+
+	// While the only slot is taken, a verification waits until its context
+	// is cancelled, without verifying the underlying block.
+	countingBlk := &countingVerifyBlock{Block: chaintest.NewBlock(genesis)}
+	bw := state.WrapBlock(countingBlk)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(bw.Verify(ctx), context.DeadlineExceeded)
+	require.Zero(countingBlk.verifyCalls)
+	require.False(state.IsProcessing(bw.ID()))
+
+	// Once the slot is released, the block can be verified.
+	close(blocking.unblock)
+	require.NoError(<-verifyErr)
+	require.NoError(bw.Verify(context.Background()))
+	require.Equal(1, countingBlk.verifyCalls)
+	require.True(state.IsProcessing(bw.ID()))
+}
+
+func TestBlockWrapperCheckHeightContinuity(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.CheckHeightContinuity = true
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(parent.Verify(ctx))
+
+	// Children of both processing and decided blocks are checked.
+	for _, parentBlk := range []*chaintest.Block{genesis, parent.Block.(*chaintest.Block)} {
+		blk := &countingVerifyBlock{Block: chaintest.NewBlock(parentBlk)}
+		blk.HeightV += 2
+		bw := state.WrapBlock(blk)
+		require.ErrorIs(bw.Verify(ctx), errHeightDiscontinuity)
+		require.Zero(blk.verifyCalls)
+		require.False(state.IsProcessing(bw.ID()))
+	}
+
+	child := state.WrapBlock(chaintest.NewBlock(parent.Block.(*chaintest.Block)))
+	require.NoError(child.Verify(ctx))
+
+	// The check is skipped if the parent isn't cached.
+	unknownParent := chaintest.NewBlock(chaintest.NewGenesis())
+	unknownParent.HeightV = 10
+	orphan := state.WrapBlock(chaintest.NewBlock(unknownParent))
+	orphan.Block.(*chaintest.Block).HeightV = 5
+	require.NoError(orphan.Verify(ctx))
+}
+
+func TestBlockWrapperReadOnly(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.ReadOnly = true
+	config.TrustedRehydrate = true
+	config.BuildBlock = func(context.Context) (block.Block, error) {
+		return chaintest.NewBlock(genesis), nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	blk2 := state.WrapBlock(chaintest.NewBlock(blk1.Block.(*chaintest.Block)))
+
+	// Blocks are only verified once their parent is accepted.
+	require.ErrorIs(blk2.Verify(ctx), errMissingParent)
+
+	// Blocks are only accepted once verified.
+	require.ErrorIs(state.ReportAccepted(ctx, blk1.ID()), errNotVerified)
+
+	// Verifying a child of the last accepted block only records it.
+	require.NoError(blk1.Verify(ctx))
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+	require.Empty(state.ProcessingIDs())
+	require.Equal(choices.Processing, blk1.Block.(*chaintest.Block).StatusV)
+
+	// The block is accepted once reported by the accepted feed.
+	require.NoError(state.ReportAccepted(ctx, blk1.ID()))
+	require.Equal(blk1.ID(), state.LastAcceptedID())
+	require.Empty(state.ProcessingIDs())
+	status, _ := state.Status(blk1.ID())
+	require.Equal(StatusAccepted, status)
+	require.Equal(choices.Accepted, blk1.Block.(*chaintest.Block).StatusV)
+
+	// Siblings of an accepted block are no longer recorded.
+	sibling := state.WrapBlock(chaintest.NewBlock(blk1.Block.(*chaintest.Block)))
+	require.NoError(blk2.Verify(ctx))
+	require.NoError(sibling.Verify(ctx))
+	require.NoError(state.ReportAccepted(ctx, blk2.ID()))
+	require.Equal(blk2.ID(), state.LastAcceptedID())
+	require.ErrorIs(state.ReportAccepted(ctx, sibling.ID()), errNotVerified)
+	require.Equal(choices.Processing, sibling.Block.(*chaintest.Block).StatusV)
+
+	// Blocks can't be built or added to the verified blocks.
+	_, err = state.BuildBlock(ctx)
+	require.ErrorIs(err, errReadOnly)
+	_, err = state.BuildBlockWithContext(ctx, &block.Context{})
+	require.ErrorIs(err, errReadOnly)
+	_, err = state.BuildVerifiedBlock(ctx)
+	require.ErrorIs(err, errReadOnly)
+	_, err = state.Rehydrate(ctx, chaintest.NewBlock(blk2.Block.(*chaintest.Block)))
+	require.ErrorIs(err, errReadOnly)
+	require.Empty(state.ProcessingIDs())
+}
+
+func TestBlockWrapperStrictParents(t *testing.T) {
+	tests := []struct {
+		name          string
+		strictParents bool
+		expectedErr   error
+	}{
+		{
+			name:          "strict",
+			strictParents: true,
+			expectedErr:   errMissingParent,
+		},
+		{
+			name:          "not strict",
+			strictParents: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.StrictParents = test.strictParents
+			state, err := NewState(config)
+			require.NoError(err)
+
+			// genesis -> orphaned -> child
+			//         \> accepted
+			ctx := context.Background()
+			orphaned := state.WrapBlock(chaintest.NewBlock(genesis))
+			child := state.WrapBlock(chaintest.NewBlock(orphaned.Block.(*chaintest.Block)))
+			accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+			require.NoError(orphaned.Verify(ctx))
+			require.NoError(accepted.Verify(ctx))
+
+			// The reorg rejects the parent before the child is verified.
+			require.NoError(accepted.Accept(ctx))
+			require.NoError(orphaned.Reject(ctx))
+
+			err = child.Verify(ctx)
+			require.ErrorIs(err, test.expectedErr)
+			require.Equal(test.expectedErr == nil, state.IsProcessing(child.ID()))
+
+			// Children of the last accepted block can always be verified.
+			next := state.WrapBlock(chaintest.NewBlock(accepted.Block.(*chaintest.Block)))
+			require.NoError(next.Verify(ctx))
+		})
+	}
+}
+
+var _ StateSummaryProvider = (*testSummaryBlock)(nil)
+
+type testSummaryBlock struct {
+	*chaintest.Block
+
+	summary []byte
+}
+
+func (b *testSummaryBlock) StateSummary() ([]byte, error) {
+	return b.summary, nil
+}
+
+func TestBlockWrapperStateSummary(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	withSummary := state.WrapBlock(&testSummaryBlock{
+		Block:   chaintest.NewBlock(genesis),
+		summary: []byte("summary"),
+	})
+	summary, err := withSummary.StateSummary()
+	require.NoError(err)
+	require.Equal([]byte("summary"), summary)
+
+	withoutSummary := state.WrapBlock(chaintest.NewBlock(genesis))
+	_, err = withoutSummary.StateSummary()
+	require.ErrorIs(err, ErrNoStateSummary)
+}
+
+func TestBlockWrapperRepeatedDecisions(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := state.WrapBlock(chaintest.NewBlock(genesis))
+	sibling := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(parent.Verify(ctx))
+	require.NoError(sibling.Verify(ctx))
+	child := state.WrapBlock(chaintest.NewBlock(parent.Block.(*chaintest.Block)))
+	require.NoError(child.Verify(ctx))
+
+	require.NoError(parent.Accept(ctx))
+	require.NoError(sibling.Reject(ctx))
+	require.NoError(child.Accept(ctx))
+
+	// Repeated decisions don't reach the underlying blocks.
+	parent.Block.(*chaintest.Block).AcceptV = errTestVerify
+	sibling.Block.(*chaintest.Block).RejectV = errTestVerify
+	require.NoError(parent.Accept(ctx))
+	require.NoError(sibling.Reject(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+
+	// Conflicting decisions are refused.
+	require.ErrorIs(parent.Reject(ctx), errConflictingDecision)
+	require.ErrorIs(sibling.Accept(ctx), errConflictingDecision)
+	status, _ := state.Status(parent.ID())
+	require.Equal(StatusAccepted, status)
+	status, _ = state.Status(sibling.ID())
+	require.Equal(StatusRejected, status)
+}
+
+var _ OracleBlockWithContext = (*testContextOracleBlock)(nil)
+
+type testContextOracleBlock struct {
+	*chaintest.Block
+
+	options [2]ContextBlock
+}
+
+func (b *testContextOracleBlock) OptionsWithContext(context.Context) ([2]ContextBlock, error) {
+	return b.options, nil
+}
+
+func TestBlockWrapperOptionsWithContext(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	oracle := &testContextOracleBlock{Block: chaintest.NewBlock(genesis)}
+	options := [2]*testContextBlock{
+		{
+			Block:                   chaintest.NewBlock(oracle.Block),
+			shouldVerifyWithContext: true,
+		},
+		{
+			Block:                   chaintest.NewBlock(oracle.Block),
+			shouldVerifyWithContext: true,
+		},
+	}
+	oracle.options = [2]ContextBlock{options[0], options[1]}
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	oracleBlk := state.WrapBlock(oracle)
+	wrappedOptions, err := oracleBlk.OptionsWithContext(ctx)
+	require.NoError(err)
+	blkOptions, err := oracleBlk.Options(ctx)
+	require.NoError(err)
+
+	// The options are verified with the block context through the caching
+	// layer.
+	blockCtx := &block.Context{PChainHeight: 1}
+	for i, option := range wrappedOptions {
+		require.Equal(blkOptions[i], option)
+		require.NoError(option.VerifyWithContext(ctx, blockCtx))
+		require.Equal(blockCtx, options[i].verifiedContext)
+		require.True(state.IsProcessing(option.ID()))
+	}
+}
+
+func TestUnwrapAs(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	oracle := &testOracleBlock{Block: chaintest.NewBlock(genesis)}
+	bw := state.WrapBlock(oracle)
+	require.Equal(oracle, bw.Unwrap())
+
+	// Wrappers of other states are unwrapped as well.
+	other, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	nested := other.WrapBlock(bw)
+	require.NotSame(bw, nested)
+
+	unwrapped, ok := UnwrapAs[*testOracleBlock](nested)
+	require.True(ok)
+	require.Same(oracle, unwrapped)
+
+	inner, ok := UnwrapAs[*chaintest.Block](nested)
+	require.False(ok)
+	require.Nil(inner)
+
+	wrapper, ok := UnwrapAs[*BlockWrapper](nested)
+	require.True(ok)
+	require.Same(nested, wrapper)
+}
+
+var _ AncestorVerifier = (*testAncestorBlock)(nil)
+
+type testAncestorBlock struct {
+	*chaintest.Block
+
+	verifiedAgainst block.Block
+}
+
+func (b *testAncestorBlock) VerifyAgainst(_ context.Context, parent block.Block) error {
+	b.verifiedAgainst = parent
+	return b.VerifyV
+}
+
+func TestBlockWrapperVerifyAgainst(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := state.WrapBlock(chaintest.NewBlock(genesis))
+	sibling := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(parent.Verify(ctx))
+	require.NoError(sibling.Verify(ctx))
+
+	child := &testAncestorBlock{Block: chaintest.NewBlock(parent.Block.(*chaintest.Block))}
+	childBlk := state.WrapBlock(child)
+	require.ErrorIs(childBlk.VerifyAgainst(ctx, sibling), errUnexpectedParent)
+	require.Nil(child.verifiedAgainst)
+
+	require.NoError(childBlk.VerifyAgainst(ctx, parent))
+	require.Same(parent.Block, child.verifiedAgainst)
+	require.True(state.IsProcessing(child.ID()))
+
+	// Blocks can't be verified against rejected parents.
+	require.NoError(sibling.Reject(ctx))
+	orphan := state.WrapBlock(&testAncestorBlock{Block: chaintest.NewBlock(sibling.Block.(*chaintest.Block))})
+	require.ErrorIs(orphan.VerifyAgainst(ctx, sibling), errRejectedParent)
+
+	plain := state.WrapBlock(chaintest.NewBlock(parent.Block.(*chaintest.Block)))
+	require.ErrorIs(plain.VerifyAgainst(ctx, parent), errExpectedAncestorVerifier)
+}
+
+// testLogHandler records the messages and attributes of the logged records.
+type testLogHandler struct {
+	records []testLogRecord
+}
+
+type testLogRecord struct {
+	level slog.Level
+	msg   string
+	attrs map[string]any
+}
+
+func (*testLogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *testLogHandler) Handle(_ context.Context, r slog.Record) error {
+	record := testLogRecord{
+		level: r.Level,
+		msg:   r.Message,
+		attrs: make(map[string]any),
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		record.attrs[attr.Key] = attr.Value.Any()
+		return true
+	})
+	h.records = append(h.records, record)
+	return nil
+}
+
+func (h *testLogHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *testLogHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func TestBlockWrapperLogsDecisions(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	handler := &testLogHandler{}
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.Log = log.NewLoggerFromHandler(handler)
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	time.Sleep(time.Millisecond)
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+
+	require.Len(handler.records, 2)
+	for i, expected := range []struct {
+		level slog.Level
+		msg   string
+		blk   *BlockWrapper
+	}{
+		{level: log.LevelInfo, msg: "accepted block", blk: accepted},
+		{level: log.LevelDebug, msg: "rejected block", blk: rejected},
+	} {
+		record := handler.records[i]
+		require.Equal(expected.level, record.level)
+		require.Equal(expected.msg, record.msg)
+		require.Equal(expected.blk.ID(), record.attrs["blkID"])
+		require.Equal(expected.blk.Height(), record.attrs["height"])
+		require.Equal(expected.blk.Parent(), record.attrs["parentID"])
+		require.GreaterOrEqual(record.attrs["processingTime"], time.Millisecond)
+	}
+}
+
+func TestBlockWrapperAcceptFailure(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	child.AcceptV = errTestVerify
+	blk := state.WrapBlock(child)
+	require.NoError(blk.Verify(ctx))
+
+	require.ErrorIs(blk.Accept(ctx), errTestVerify)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+	require.True(state.IsProcessing(child.ID()))
+	status, _ := state.Status(child.ID())
+	require.Equal(StatusProcessing, status)
+	_, err = state.GetBlockIDAtHeight(ctx, child.Height())
+	require.ErrorIs(err, database.ErrNotFound)
+
+	// The block can be accepted once the underlying block succeeds.
+	child.AcceptV = nil
+	require.NoError(blk.Accept(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+	require.False(state.IsProcessing(child.ID()))
+}
+
+// testSlowBlock is a block whose Accept and Reject wait for their context to
+// be done.
+type testSlowBlock struct {
+	*chaintest.Block
+}
+
+func (*testSlowBlock) Accept(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (*testSlowBlock) Reject(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestBlockWrapperDecisionTimeout(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.DecisionTimeout = time.Millisecond
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	accepted := &testSlowBlock{Block: chaintest.NewBlock(genesis)}
+	rejected := &testSlowBlock{Block: chaintest.NewBlock(genesis)}
+	acceptedBlk := state.WrapBlock(accepted)
+	rejectedBlk := state.WrapBlock(rejected)
+	require.NoError(acceptedBlk.Verify(ctx))
+	require.NoError(rejectedBlk.Verify(ctx))
+
+	// Timed out decisions leave the blocks processing.
+	err = acceptedBlk.Accept(ctx)
+	require.ErrorIs(err, ErrDecisionTimeout)
+	require.ErrorIs(err, context.DeadlineExceeded)
+	require.ErrorIs(rejectedBlk.Reject(ctx), ErrDecisionTimeout)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+	require.True(state.IsProcessing(accepted.ID()))
+	require.True(state.IsProcessing(rejected.ID()))
+
+	// Deadlines set by the caller take precedence over the timeout.
+	canceledCtx, cancel := context.WithTimeout(ctx, time.Hour)
+	cancel()
+	err = acceptedBlk.Accept(canceledCtx)
+	require.ErrorIs(err, context.Canceled)
+	require.NotErrorIs(err, ErrDecisionTimeout)
+	require.True(state.IsProcessing(accepted.ID()))
+}
+
+func TestBlockWrapperRejectFailure(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	child.RejectV = errTestVerify
+	blk := state.WrapBlock(child)
+	require.NoError(blk.Verify(ctx))
+
+	require.ErrorIs(blk.Reject(ctx), errTestVerify)
+	require.True(state.IsProcessing(child.ID()))
+	_, decided := state.decision(child.ID())
+	require.False(decided)
+	require.Equal(CacheLocationVerified, blk.CacheLocation())
+
+	// The block can be rejected once the underlying block succeeds.
+	child.RejectV = nil
+	require.NoError(blk.Reject(ctx))
+	status, _ := state.Status(child.ID())
+	require.Equal(StatusRejected, status)
+}
+
+func TestBlockWrapperCachesPermanentVerifyFailures(t *testing.T) {
+	require := require.New(t)
+
+	var (
+		errPermanent = errors.New("permanent")
+		errTemporary = errors.New("temporary")
+	)
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.PermanentVerifyErrors = []error{errPermanent}
+	var calls int
+	config.PreVerify = func(context.Context, block.Block) error {
+		calls++
+		return nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+
+	temporary := chaintest.NewBlock(genesis)
+	temporary.VerifyV = errTemporary
+	temporaryBlk := state.WrapBlock(temporary)
+	require.ErrorIs(temporaryBlk.Verify(ctx), errTemporary)
+	require.ErrorIs(temporaryBlk.Verify(ctx), errTemporary)
+	require.Equal(2, calls)
+
+	// Permanent failures are returned without verifying the block again.
+	permanent := chaintest.NewBlock(genesis)
+	permanent.VerifyV = fmt.Errorf("malformed: %w", errPermanent)
+	permanentBlk := state.WrapBlock(permanent)
+	require.ErrorIs(permanentBlk.Verify(ctx), errPermanent)
+	permanent.VerifyV = nil
+	require.ErrorIs(permanentBlk.Verify(ctx), errPermanent)
+	require.ErrorIs(state.WrapBlock(permanent).Verify(ctx), errPermanent)
+	require.Equal(3, calls)
+	require.False(state.IsProcessing(permanent.ID()))
+}
+
+var _ OracleBlockN = (*testOracleBlockN)(nil)
+
+type testOracleBlockN struct {
+	*chaintest.Block
+
+	options      []block.Block
+	optionsCalls int
+}
+
+func (b *testOracleBlockN) OptionsN(context.Context) ([]block.Block, error) {
+	b.optionsCalls++
+	return b.options, nil
+}
+
+func TestBlockWrapperOptionsN(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	oracle := &testOracleBlockN{Block: chaintest.NewBlock(genesis)}
+	for range 3 {
+		oracle.options = append(oracle.options, chaintest.NewBlock(oracle.Block))
+	}
+	blk := state.WrapBlock(oracle)
+
+	options, err := blk.OptionsN(ctx)
+	require.NoError(err)
+	require.Len(options, 3)
+	for i, option := range options {
+		require.IsType(&BlockWrapper{}, option)
+		require.Equal(oracle.options[i].ID(), option.ID())
+
+		cachedOption, err := state.GetBlock(ctx, option.ID())
+		require.NoError(err)
+		require.Same(option, cachedOption)
+	}
+
+	options2, err := blk.OptionsN(ctx)
+	require.NoError(err)
+	require.Equal(options, options2)
+	require.Equal(1, oracle.optionsCalls)
+
+	// Oracle blocks with two options are supported as well.
+	twoOptions := &testOracleBlock{Block: chaintest.NewBlock(genesis)}
+	twoOptions.options = [2]block.Block{chaintest.NewBlock(twoOptions.Block), chaintest.NewBlock(twoOptions.Block)}
+	options, err = state.WrapBlock(twoOptions).OptionsN(ctx)
+	require.NoError(err)
+	require.Len(options, 2)
+
+	_, err = state.WrapBlock(chaintest.NewBlock(genesis)).OptionsN(ctx)
+	require.ErrorIs(err, ErrNotOracle)
+}
+
+func TestBlockWrapperOnAccept(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	var (
+		state    *State
+		accepted []*BlockWrapper
+	)
+	config.OnAccept = func(_ context.Context, bw *BlockWrapper) error {
+		// The callback observes the new last accepted block.
+		require.Same(bw, state.LastAcceptedBlock())
+		require.False(state.IsProcessing(bw.ID()))
+		accepted = append(accepted, bw)
+		return errTestVerify
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk.Verify(ctx))
+	// Errors from the callback are not returned.
+	require.NoError(blk.Accept(ctx))
+	require.Equal([]*BlockWrapper{blk}, accepted)
+
+	// The callback is not called for failed or repeated accepts.
+	require.NoError(blk.Accept(ctx))
+	failed := chaintest.NewBlock(blk.Block.(*chaintest.Block))
+	failed.AcceptV = errTestVerify
+	failedBlk := state.WrapBlock(failed)
+	require.NoError(failedBlk.Verify(ctx))
+	require.ErrorIs(failedBlk.Accept(ctx), errTestVerify)
+	require.Len(accepted, 1)
+}
+
+// busyVerifyBlock spins for [work] in Verify, recording the peak number of
+// concurrent verifications in [active].
+type busyVerifyBlock struct {
+	*chaintest.Block
+
+	work   time.Duration
+	active *verifyGauge
+}
+
+type verifyGauge struct {
+	current atomic.Int64
+	peak    atomic.Int64
+}
+
+func (b *busyVerifyBlock) Verify(ctx context.Context) error {
+	current := b.active.current.Add(1)
+	defer b.active.current.Add(-1)
+	for {
+		peak := b.active.peak.Load()
+		if current <= peak || b.active.peak.CompareAndSwap(peak, current) {
+			break
+		}
+	}
+
+	for start := time.Now(); time.Since(start) < b.work; {
+	}
+	return b.Block.Verify(ctx)
+}
+
+// BenchmarkVerifyStorm verifies many sibling blocks at once, reporting the
+// peak number of underlying verifications running concurrently for each
+// [Config.MaxConcurrentVerify].
+func BenchmarkVerifyStorm(b *testing.B) {
+	for _, maxConcurrentVerify := range []int{0, 1, 2} {
+		b.Run(fmt.Sprintf("max=%d", maxConcurrentVerify), func(b *testing.B) {
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.MaxConcurrentVerify = maxConcurrentVerify
+			state, err := NewState(config)
+			require.NoError(b, err)
+
+			active := &verifyGauge{}
+			ctx := context.Background()
+			b.SetParallelism(4)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					blk := state.WrapBlock(&busyVerifyBlock{
+						Block:  chaintest.NewBlock(genesis),
+						work:   20 * time.Microsecond,
+						active: active,
+					})
+					if err := blk.Verify(ctx); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.ReportMetric(float64(active.peak.Load()), "peak-verifying")
+		})
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+)
+
+var _ Builder = (*State)(nil)
+
+// Builder produces new blocks on top of the preferred block. It is implemented
+// by State using [Config.BuildBlock] and [Config.BuildBlockWithContext].
+type Builder interface {
+	// BuildBlock builds a block and caches it as unverified.
+	BuildBlock(ctx context.Context) (block.Block, error)
+	// BuildBlockWithContext builds a block with a block context and caches it
+	// as unverified.
+	BuildBlockWithContext(ctx context.Context, blockCtx *block.Context) (block.Block, error)
+	// BuildVerifiedBlock builds a block and adds it to the processing blocks.
+	BuildVerifiedBlock(ctx context.Context) (*BlockWrapper, error)
+}
+
+// BuildVerifiedBlock builds a new block with [Config.BuildBlock] and adds it
+// to the processing blocks, as a block built by the VM is implicitly valid.
+// The canonical wrapper is returned, so a later Verify of the block does not
+// verify the underlying block.
+//
+// As for any verified block, the caller must ensure that the block is
+// eventually accepted or rejected.
+func (s *State) BuildVerifiedBlock(ctx context.Context) (*BlockWrapper, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
+	blk, err := s.buildBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bw := s.WrapBlock(blk)
+	if err := s.addVerified(bw); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
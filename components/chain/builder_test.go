@@ -0,0 +1,45 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestBuildVerifiedBlock(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	built := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.BuildBlock = func(context.Context) (block.Block, error) {
+		return built, nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	bw, err := state.BuildVerifiedBlock(ctx)
+	require.NoError(err)
+	require.Equal(built, bw.Block)
+	require.True(state.IsProcessing(built.ID()))
+
+	// Verifying the canonical wrapper doesn't verify the underlying block.
+	built.VerifyV = errTestVerify
+	blk, err := state.GetBlock(ctx, built.ID())
+	require.NoError(err)
+	require.Same(bw, blk)
+	require.NoError(blk.Verify(ctx))
+
+	// Once decided, the block can't be built again.
+	require.NoError(bw.Accept(ctx))
+	_, err = state.BuildVerifiedBlock(ctx)
+	require.ErrorIs(err, errBlockAlreadyDecided)
+}
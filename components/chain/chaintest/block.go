@@ -0,0 +1,196 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+// Package chaintest provides in-memory blocks for testing the chain component
+// and the VMs built on it.
+package chaintest
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/luxfi/consensus/core/choices"
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+)
+
+var (
+	_ block.Block             = (*Block)(nil)
+	_ block.WithVerifyContext = (*ContextBlock)(nil)
+
+	// GenesisTimestamp is the timestamp of the blocks created by NewGenesis.
+	GenesisTimestamp = time.Unix(1, 0)
+)
+
+// Block is a configurable block.Block. The fields ending in V are returned by
+// the corresponding methods.
+type Block struct {
+	IDV        ids.ID
+	ParentV    ids.ID
+	HeightV    uint64
+	TimestampV time.Time
+	BytesV     []byte
+	StatusV    choices.Status
+
+	// VerifyV, AcceptV and RejectV are returned by Verify, Accept and Reject.
+	// The status of the block is only updated by Accept and Reject if they
+	// return nil.
+	VerifyV error
+	AcceptV error
+	RejectV error
+}
+
+// NewGenesis returns an accepted block at height 0.
+func NewGenesis() *Block {
+	blkID := ids.GenerateTestID()
+	return &Block{
+		IDV:        blkID,
+		TimestampV: GenesisTimestamp,
+		BytesV:     blkID[:],
+		StatusV:    choices.Accepted,
+	}
+}
+
+// NewBlock returns a processing child of [parent]. Its bytes are its ID, and
+// it is timestamped one second after [parent].
+func NewBlock(parent *Block) *Block {
+	blkID := ids.GenerateTestID()
+	return &Block{
+		IDV:        blkID,
+		ParentV:    parent.IDV,
+		HeightV:    parent.HeightV + 1,
+		TimestampV: parent.TimestampV.Add(time.Second),
+		BytesV:     blkID[:],
+		StatusV:    choices.Processing,
+	}
+}
+
+// NewChain returns [length] processing blocks, each the child of the previous
+// one, starting from a child of [parent].
+func NewChain(parent *Block, length int) []*Block {
+	blks := make([]*Block, length)
+	for i := range blks {
+		parent = NewBlock(parent)
+		blks[i] = parent
+	}
+	return blks
+}
+
+func (b *Block) ID() ids.ID {
+	return b.IDV
+}
+
+func (b *Block) Parent() ids.ID {
+	return b.ParentV
+}
+
+func (b *Block) ParentID() ids.ID {
+	return b.ParentV
+}
+
+func (b *Block) Height() uint64 {
+	return b.HeightV
+}
+
+func (b *Block) Timestamp() time.Time {
+	return b.TimestampV
+}
+
+func (b *Block) Bytes() []byte {
+	return b.BytesV
+}
+
+func (b *Block) Status() uint8 {
+	return uint8(b.StatusV)
+}
+
+func (b *Block) Verify(context.Context) error {
+	return b.VerifyV
+}
+
+func (b *Block) Accept(context.Context) error {
+	if b.AcceptV != nil {
+		return b.AcceptV
+	}
+	b.StatusV = choices.Accepted
+	return nil
+}
+
+func (b *Block) Reject(context.Context) error {
+	if b.RejectV != nil {
+		return b.RejectV
+	}
+	b.StatusV = choices.Rejected
+	return nil
+}
+
+// ContextBlock is a Block that implements block.WithVerifyContext.
+type ContextBlock struct {
+	*Block
+
+	ShouldVerifyWithContextV bool
+	// VerifyWithContextV is returned by VerifyWithContext.
+	VerifyWithContextV error
+	// VerifiedContext is the block context passed to the last call to
+	// VerifyWithContext.
+	VerifiedContext *block.Context
+}
+
+func (b *ContextBlock) ShouldVerifyWithContext(context.Context) (bool, error) {
+	return b.ShouldVerifyWithContextV, nil
+}
+
+func (b *ContextBlock) VerifyWithContext(_ context.Context, blockCtx *block.Context) error {
+	b.VerifiedContext = blockCtx
+	return b.VerifyWithContextV
+}
+
+// OracleBlock is a Block whose options are OptionsV. It implements the
+// OracleBlock interface of the chain package.
+type OracleBlock struct {
+	*Block
+
+	OptionsV [2]block.Block
+	// OptionsErr, if non-nil, is returned by Options instead of OptionsV.
+	OptionsErr error
+}
+
+func (b *OracleBlock) Options(context.Context) ([2]block.Block, error) {
+	if b.OptionsErr != nil {
+		return [2]block.Block{}, b.OptionsErr
+	}
+	return b.OptionsV, nil
+}
+
+// Blocks is an in-memory block store, whose GetBlock and ParseBlock methods
+// can back a chain.Config.
+type Blocks map[ids.ID]block.Block
+
+// Put adds [blks] to the store.
+func (b Blocks) Put(blks ...block.Block) {
+	for _, blk := range blks {
+		b[blk.ID()] = blk
+	}
+}
+
+// GetBlock returns the block with ID [blkID], or database.ErrNotFound.
+func (b Blocks) GetBlock(_ context.Context, blkID ids.ID) (block.Block, error) {
+	blk, ok := b[blkID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return blk, nil
+}
+
+// ParseBlock returns the block whose bytes are [blkBytes], or
+// database.ErrNotFound.
+func (b Blocks) ParseBlock(_ context.Context, blkBytes []byte) (block.Block, error) {
+	for _, blk := range b {
+		if bytes.Equal(blk.Bytes(), blkBytes) {
+			return blk, nil
+		}
+	}
+	return nil, database.ErrNotFound
+}
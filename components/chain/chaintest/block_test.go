@@ -0,0 +1,129 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chaintest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/core/choices"
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/vms/components/chain"
+)
+
+var (
+	_ chain.OracleBlock = (*OracleBlock)(nil)
+
+	errTest = errors.New("test")
+)
+
+func TestNewChain(t *testing.T) {
+	require := require.New(t)
+
+	genesis := NewGenesis()
+	require.Equal(uint8(choices.Accepted), genesis.Status())
+
+	blks := NewChain(genesis, 3)
+	require.Len(blks, 3)
+	parent := genesis
+	for _, blk := range blks {
+		require.Equal(parent.ID(), blk.Parent())
+		require.Equal(parent.Height()+1, blk.Height())
+		require.True(blk.Timestamp().After(parent.Timestamp()))
+		require.Equal(uint8(choices.Processing), blk.Status())
+		parent = blk
+	}
+}
+
+func TestBlockDecisions(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := NewGenesis()
+	accepted := NewBlock(genesis)
+	require.NoError(accepted.Accept(ctx))
+	require.Equal(uint8(choices.Accepted), accepted.Status())
+
+	rejected := NewBlock(genesis)
+	require.NoError(rejected.Reject(ctx))
+	require.Equal(uint8(choices.Rejected), rejected.Status())
+
+	failing := NewBlock(genesis)
+	failing.VerifyV = errTest
+	failing.AcceptV = errTest
+	failing.RejectV = errTest
+	require.ErrorIs(failing.Verify(ctx), errTest)
+	require.ErrorIs(failing.Accept(ctx), errTest)
+	require.ErrorIs(failing.Reject(ctx), errTest)
+	require.Equal(uint8(choices.Processing), failing.Status())
+}
+
+func TestBlocksBackState(t *testing.T) {
+	require := require.New(t)
+
+	genesis := NewGenesis()
+	blks := NewChain(genesis, 2)
+	store := Blocks{}
+	store.Put(genesis, blks[0], blks[1])
+
+	state, err := chain.NewState(&chain.Config{
+		DecidedCacheSize:    1024,
+		MissingCacheSize:    1024,
+		UnverifiedCacheSize: 1024,
+		BytesToIDCacheSize:  1024,
+		LastAcceptedBlock:   genesis,
+		GetBlock:            store.GetBlock,
+		UnmarshalBlock:      store.ParseBlock,
+	})
+	require.NoError(err)
+
+	ctx := context.Background()
+	for _, blk := range blks {
+		wrapped, err := state.ParseBlock(ctx, blk.Bytes())
+		require.NoError(err)
+		require.NoError(wrapped.Verify(ctx))
+		require.NoError(wrapped.Accept(ctx))
+	}
+	require.Equal(blks[1].ID(), state.LastAcceptedID())
+
+	_, err = store.ParseBlock(ctx, []byte{0})
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestContextBlock(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	blk := &ContextBlock{
+		Block:                    NewBlock(NewGenesis()),
+		ShouldVerifyWithContextV: true,
+		VerifyWithContextV:       errTest,
+	}
+	shouldVerify, err := blk.ShouldVerifyWithContext(ctx)
+	require.NoError(err)
+	require.True(shouldVerify)
+
+	blockCtx := &block.Context{PChainHeight: 1}
+	require.ErrorIs(blk.VerifyWithContext(ctx, blockCtx), errTest)
+	require.Equal(blockCtx, blk.VerifiedContext)
+}
+
+func TestOracleBlock(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	oracle := &OracleBlock{Block: NewBlock(NewGenesis())}
+	oracle.OptionsV = [2]block.Block{NewBlock(oracle.Block), NewBlock(oracle.Block)}
+	options, err := oracle.Options(ctx)
+	require.NoError(err)
+	require.Equal(oracle.OptionsV, options)
+
+	oracle.OptionsErr = errTest
+	_, err = oracle.Options(ctx)
+	require.ErrorIs(err, errTest)
+}
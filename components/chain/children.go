@@ -0,0 +1,71 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/utils/linked"
+)
+
+// childrenIndex maps the IDs of parent blocks to the IDs of their decided
+// children. Only the [maxParents] most recently indexed parents are retained.
+type childrenIndex struct {
+	lock       sync.Mutex
+	maxParents int
+	// children is ordered from least to most recently indexed parent.
+	children *linked.Hashmap[ids.ID, []ids.ID]
+}
+
+func newChildrenIndex(maxParents int) *childrenIndex {
+	return &childrenIndex{
+		maxParents: maxParents,
+		children:   linked.NewHashmap[ids.ID, []ids.ID](),
+	}
+}
+
+// add records that [childID], a child of [parentID], was decided.
+func (c *childrenIndex) add(parentID ids.ID, childID ids.ID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	children, ok := c.children.Get(parentID)
+	if !ok && c.children.Len() >= c.maxParents {
+		oldestParentID, _, _ := c.children.Oldest()
+		c.children.Delete(oldestParentID)
+	}
+	if slices.Contains(children, childID) {
+		return
+	}
+	c.children.Put(parentID, append(children, childID))
+}
+
+// get returns a copy of the decided children of [parentID].
+func (c *childrenIndex) get(parentID ids.ID) []ids.ID {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	children, _ := c.children.Get(parentID)
+	return slices.Clone(children)
+}
+
+// Children returns the IDs of the decided children of [parentID], both
+// accepted and rejected, in the order they were decided. Returns nil if
+// [Config.ChildrenIndexDepth] is zero or if [parentID] is no longer indexed.
+func (s *State) Children(parentID ids.ID) []ids.ID {
+	if s.children == nil {
+		return nil
+	}
+	return s.children.get(parentID)
+}
+
+// indexChild records the decision of [bw] in the children index, if it is
+// enabled.
+func (s *State) indexChild(bw *BlockWrapper) {
+	if s.children != nil {
+		s.children.add(bw.Parent(), bw.key())
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestStateChildren(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.ChildrenIndexDepth = 1
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// genesis -> accepted -> child
+	//         \> rejected
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+	require.Equal([]ids.ID{accepted.ID(), rejected.ID()}, state.Children(genesis.ID()))
+
+	// Only the most recent parent is retained.
+	child := state.WrapBlock(chaintest.NewBlock(accepted.Block.(*chaintest.Block)))
+	require.NoError(child.Verify(ctx))
+	require.NoError(child.Accept(ctx))
+	require.Equal([]ids.ID{child.ID()}, state.Children(accepted.ID()))
+	require.Empty(state.Children(genesis.ID()))
+}
+
+func TestStateChildrenDisabled(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Nil(state.Children(genesis.ID()))
+}
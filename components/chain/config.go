@@ -0,0 +1,388 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/log"
+)
+
+const (
+	// DefaultDecidedCacheSize is the default byte budget of the decided block
+	// cache.
+	DefaultDecidedCacheSize = 64 * 1024 * 1024
+	// DefaultMissingCacheSize is the default number of missing block IDs that
+	// are remembered.
+	DefaultMissingCacheSize = 2048
+	// DefaultUnverifiedCacheSize is the default byte budget of the unverified
+	// block cache.
+	DefaultUnverifiedCacheSize = 64 * 1024 * 1024
+	// DefaultBytesToIDCacheSize is the default byte budget of the cache mapping
+	// block bytes to block IDs.
+	DefaultBytesToIDCacheSize = 64 * 1024 * 1024
+	// DefaultHeightIndexCacheSize is the default number of accepted heights
+	// whose block IDs are indexed in memory.
+	DefaultHeightIndexCacheSize = 2048
+	// DefaultFailedVerifyCacheSize is the default number of blocks whose
+	// permanent verification failures are remembered.
+	DefaultFailedVerifyCacheSize = 2048
+	// MaxOrphanScan is the maximum number of verified blocks scanned for
+	// orphans by [Config.AutoOrphanCleanup] when a block is accepted.
+	MaxOrphanScan = 4096
+	// DefaultAcceptedChSize is the default number of accepted block IDs
+	// buffered by [State.AcceptedCh].
+	DefaultAcceptedChSize = 256
+	// DefaultVerifyRetryBackoff is the default delay before the first retry
+	// of a verification enabled by [Config.MaxVerifyRetries].
+	DefaultVerifyRetryBackoff = 100 * time.Millisecond
+)
+
+var (
+	errNegativeCacheSize           = errors.New("cache size must be non-negative")
+	errNegativeMaxProcessing       = errors.New("max processing must be non-negative")
+	errNegativeMaxConcurrentVerify = errors.New("max concurrent verify must be non-negative")
+	errNegativeTTL                 = errors.New("ttl must be non-negative")
+	errNegativeTimeout             = errors.New("timeout must be non-negative")
+	errNegativeMaxVerifyRetries    = errors.New("max verify retries must be non-negative")
+	errNegativeMaxPendingBlocks    = errors.New("max pending blocks must be non-negative")
+	errNegativeAcceptedChSize      = errors.New("accepted channel size must be non-negative")
+	errNegativeChildrenIndexDepth  = errors.New("children index depth must be non-negative")
+)
+
+// Config defines all of the parameters necessary to initialize State
+type Config struct {
+	// Cache configuration. A size of zero selects the corresponding default.
+	//
+	// DecidedCacheSize is the byte budget of the cache of decided (accepted or
+	// rejected) blocks.
+	DecidedCacheSize int
+	// MissingCacheSize is the number of block IDs, unknown to the VM, that are
+	// remembered to avoid repeated lookups. A block ID is forgotten once a
+	// block with that ID is parsed, verified or accepted.
+	MissingCacheSize int
+	// UnverifiedCacheSize is the byte budget of the cache of blocks that have
+	// been parsed or fetched but not yet verified.
+	UnverifiedCacheSize int
+	// UnverifiedTTL, if non-zero, is the duration after which a block that
+	// was cached as unverified is evicted, even if the cache has room for
+	// it. Expired blocks are evicted lazily when they are looked up, and
+	// periodically by a background sweep that stops when the State is
+	// closed.
+	UnverifiedTTL time.Duration
+	// BytesToIDCacheSize is the byte budget of the cache mapping block bytes to
+	// block IDs, used to skip unmarshalling known blocks.
+	BytesToIDCacheSize int
+	// HeightIndexCacheSize is the number of the most recently accepted heights
+	// whose block IDs are indexed by [State.GetBlockIDAtHeight].
+	HeightIndexCacheSize int
+	// FailedVerifyCacheSize is the number of blocks whose permanent
+	// verification failures, as defined by [Config.PermanentVerifyErrors],
+	// are remembered.
+	FailedVerifyCacheSize int
+
+	// MissingParentErr is the error returned by the VM when verifying a block
+	// whose parent is not yet available. Blocks that fail verification with
+	// this error, as determined by errors.Is, are parked and verified again
+	// once a block with the ID of their parent is verified or accepted. The
+	// original verification still returns the error, so a parked block that
+	// later passes verification is only cached as unverified, without
+	// processing, for consensus to verify it again.
+	MissingParentErr error
+	// MaxPendingBlocks is the maximum number of blocks parked waiting for
+	// their parent. Once reached, the oldest parked block is dropped. Parking
+	// is disabled if this is zero or if [Config.MissingParentErr] is nil.
+	MaxPendingBlocks int
+
+	// PermanentVerifyErrors are the errors that mark a verification failure
+	// as permanent, as determined by errors.Is. Blocks that fail verification
+	// with a permanent error are not verified again; the failure is returned
+	// from the cache instead. Other failures are assumed to be temporary
+	// and are never cached.
+	PermanentVerifyErrors []error
+	// IsTemporaryVerifyError, if non-nil, reports whether a verification
+	// failure of the underlying block is temporary, such as when a warp
+	// message referenced by the block wasn't fetched yet. Verifications
+	// failing with a temporary error are retried up to
+	// [Config.MaxVerifyRetries] times, rather than failing back to consensus.
+	IsTemporaryVerifyError func(error) bool
+	// MaxVerifyRetries is the number of times a verification failing with a
+	// temporary error is retried. Zero, the default, disables retries. Only
+	// the failure of the last attempt is returned, and cached if it is
+	// permanent.
+	MaxVerifyRetries int
+	// VerifyRetryBackoff is the delay before the first retry of a
+	// verification, doubling before every following retry. Retrying stops
+	// once the context of the verification is cancelled. Zero selects
+	// [DefaultVerifyRetryBackoff].
+	VerifyRetryBackoff time.Duration
+
+	// ChildrenIndexDepth is the number of parent blocks whose decided
+	// children are retained for [State.Children]. This is intended for
+	// diagnostics, such as inspecting the rejected siblings of accepted
+	// blocks. Zero disables the index.
+	ChildrenIndexDepth int
+
+	// DecidedEvictionPolicy determines when decided blocks are evicted. If
+	// nil, [LRUPolicy] is used.
+	DecidedEvictionPolicy EvictionPolicy
+	// DisableDecidedCache causes no decided block to be cached, other than
+	// the last accepted block, overriding [Config.DecidedEvictionPolicy].
+	// This is intended for nodes that never look up decided blocks again,
+	// such as state sync bootstrap nodes. Other decided blocks are then
+	// reported as unknown by [State.Status] and loaded from the VM by
+	// [State.GetBlock], and deciding such a block again decides the
+	// underlying block again.
+	DisableDecidedCache bool
+	// DisableRejectedCache causes rejected blocks not to be added to the
+	// decided blocks by [BlockWrapper.Reject], so that they don't evict
+	// accepted blocks. This is intended for VMs that never look up rejected
+	// blocks again. Such blocks are then reported as unknown by
+	// [State.Status] and loaded from the VM by [State.GetBlock].
+	DisableRejectedCache bool
+	// VerifiedMap determines how the verified blocks are held. If nil,
+	// [PlainMap] is used. VMs verifying many blocks concurrently may use a
+	// [ShardedMap] to reduce lock contention.
+	VerifiedMap VerifiedMap
+
+	// MaxProcessing is the maximum number of verified blocks that may be
+	// processing in consensus at once. Verifying a block beyond this limit
+	// fails without verifying the underlying block. The last accepted block
+	// does not count towards the limit. Zero means no limit.
+	MaxProcessing int
+	// MaxConcurrentVerify is the maximum number of underlying blocks that may
+	// be verified at once. Verifications beyond this limit wait for a slot,
+	// or fail once their context is cancelled. The underlying Verify must not
+	// verify other blocks through State while holding a slot. Zero means no
+	// limit.
+	MaxConcurrentVerify int
+
+	// CascadeReject causes the verified descendants of a rejected block to be
+	// evicted from the verified blocks when the block is rejected. Consensus
+	// is still expected to reject each of the descendants.
+	CascadeReject bool
+	// AutoOrphanCleanup causes the verified blocks that no longer descend
+	// from the last accepted block to be evicted from the verified blocks
+	// whenever a block is accepted, such as the siblings of the accepted
+	// block and their descendants. The orphaned blocks are not rejected, as
+	// consensus is still expected to reject each of them. To bound the cost
+	// of accepting a block, nothing is evicted while more than
+	// [MaxOrphanScan] blocks are processing.
+	AutoOrphanCleanup bool
+
+	// CheckHeightContinuity causes Verify to fail, without verifying the
+	// underlying block, if the parent of the block is cached and the height
+	// of the block isn't the height of its parent plus one. The check is
+	// skipped if the parent isn't cached.
+	CheckHeightContinuity bool
+
+	// StrictParents causes Verify to fail for blocks whose parent is neither
+	// the last accepted block nor processing in consensus.
+	StrictParents bool
+
+	// ReadOnly configures State for follower nodes that are fed accepted
+	// blocks and never participate in consensus. Verifying a block whose
+	// parent is the last accepted block only records that it was verified,
+	// without adding it to the verified blocks; verifying any other block
+	// fails. A verified block is accepted once the feed of accepted blocks
+	// reports it with [State.ReportAccepted]. Building blocks, and otherwise
+	// adding blocks to the verified blocks, is disallowed.
+	ReadOnly bool
+
+	// TrustedRehydrate allows [State.Rehydrate] to be used. It must only be
+	// set if the engine guarantees that every block it rehydrates was
+	// previously verified.
+	TrustedRehydrate bool
+
+	// StrictVerifyContext causes VerifyWithContext to fail, rather than fall
+	// back to Verify, for blocks that don't implement
+	// block.WithVerifyContext.
+	StrictVerifyContext bool
+	// ValidateContext, if non-nil, is called with the block context at the
+	// start of every VerifyWithContext, such as to reject a stale P-Chain
+	// height. If it returns an error, verification is aborted with that error
+	// before any cache is touched. ValidateContext must not call back into
+	// State.
+	ValidateContext func(*block.Context) error
+
+	// OnEvict, if non-nil, is called with the underlying block whenever a
+	// block is evicted from the decided or unverified block caches to make
+	// room for other blocks, or because it expired under [TTLPolicy]. It is
+	// not called when a block leaves a cache for another one, such as when an
+	// unverified block is verified, nor when the caches are flushed.
+	//
+	// OnEvict is called synchronously by the goroutine that caused the
+	// eviction, after the cache and State have released their locks. It may
+	// therefore call back into State, but it must be safe for concurrent use
+	// and should return quickly. The evicted block may still be returned by
+	// later lookups if it is loaded again from the VM.
+	OnEvict func(blkID ids.ID, blk block.Block)
+
+	// KeyFunc, if non-nil, derives the key of a block in the block caches
+	// and [Config.DecidedStore]. If nil, blocks are keyed by their ID.
+	//
+	// Blocks are looked up with the IDs given by consensus, such as by
+	// [State.GetBlock] and when resolving the parent of a block, so KeyFunc
+	// must map every block to the ID it is looked up by. It is intended for
+	// experimenting with the keying of the caches.
+	KeyFunc func(block.Block) ids.ID
+
+	// AcceptedChSize is the number of accepted block IDs buffered by
+	// [State.AcceptedCh]. Zero selects [DefaultAcceptedChSize].
+	AcceptedChSize int
+
+	// OnAccept, if non-nil, is called with the wrapper of every block that is
+	// accepted, once the underlying block was accepted and State reflects the
+	// new last accepted block. Errors returned by OnAccept are logged, but not
+	// returned from Accept.
+	OnAccept func(context.Context, *BlockWrapper) error
+	// DecisionTimeout, if non-zero, bounds the context passed to the
+	// underlying Accept and Reject when the context given by consensus has no
+	// deadline. If the underlying call fails once the timeout expired,
+	// [ErrDecisionTimeout] is returned and the block is left processing. The
+	// timeout is only enforced if the VM respects the cancellation of the
+	// context.
+	DecisionTimeout time.Duration
+
+	// ProvideParentState causes the state root of the parent of a block to be
+	// passed to the verification of the underlying block, through the
+	// context value retrieved by [ParentStateRoot], if the parent is
+	// processing or last accepted and implements [ParentStateProvider]. This
+	// allows the VM to verify blocks without loading the state of their
+	// parent itself, such as when verifying blocks in parallel.
+	ProvideParentState bool
+	// ShareOptionParentState causes the state root provided by
+	// [Config.ProvideParentState] to be computed once for both options of an
+	// [OracleBlock] or [OracleBlockWithContext], rather than once per option.
+	// Verifying an option whose sibling was already verified then doesn't
+	// load the state root of their common parent again. It has no effect
+	// unless [Config.ProvideParentState] is set.
+	ShareOptionParentState bool
+
+	// PreVerify, if non-nil, is called with the underlying block before it is
+	// verified. If PreVerify returns an error, verification is aborted and the
+	// error is returned. PreVerify must not call back into State.
+	PreVerify func(context.Context, block.Block) error
+
+	// DecidedStore, if non-nil, persists accepted blocks behind the decided
+	// block cache. Accepted blocks are written to it, and blocks that aren't
+	// cached are read from it before falling back to GetBlock. Errors from
+	// the store are counted but never fail an operation.
+	DecidedStore DecidedStore
+
+	// GetBlockIDAtHeight, if non-nil, is used by [State.GetBlockIDAtHeight]
+	// to look up accepted heights that are no longer indexed in memory. It
+	// should return [database.ErrNotFound] if there is no accepted block at
+	// the height.
+	GetBlockIDAtHeight func(context.Context, uint64) (ids.ID, error)
+
+	// Tracer, if non-nil, is used to start a span for every verification,
+	// accept and reject of a block, named "chain.Verify",
+	// "chain.VerifyWithContext", "chain.Accept" and "chain.Reject"
+	// respectively. The spans are children of the span in the context given
+	// by consensus, and their context is passed to the underlying block.
+	Tracer Tracer
+
+	// Log is used to report block decisions, and unexpected calls made by
+	// consensus. Accepted blocks are logged at Info and rejected blocks at
+	// Debug, along with the time they spent processing. If nil, nothing is
+	// logged. This is typically the logger passed to the VM's factory.
+	Log log.Logger
+
+	// LastAcceptedBlock is the last accepted block, which is always cached as
+	// decided. If nil, [State.Initialize] must be called with the last
+	// accepted block before blocks are verified or decided.
+	LastAcceptedBlock     block.Block
+	GetBlock              func(context.Context, ids.ID) (block.Block, error)
+	UnmarshalBlock        func(context.Context, []byte) (block.Block, error)
+	BatchedUnmarshalBlock func(context.Context, [][]byte) ([]block.Block, error)
+	BuildBlock            func(context.Context) (block.Block, error)
+	BuildBlockWithContext func(context.Context, *block.Context) (block.Block, error)
+}
+
+// Verify returns an error if [c] is not a valid configuration.
+func (c *Config) Verify() error {
+	switch {
+	case c.DecidedCacheSize < 0:
+		return fmt.Errorf("%w: DecidedCacheSize (%d)", errNegativeCacheSize, c.DecidedCacheSize)
+	case c.MissingCacheSize < 0:
+		return fmt.Errorf("%w: MissingCacheSize (%d)", errNegativeCacheSize, c.MissingCacheSize)
+	case c.UnverifiedCacheSize < 0:
+		return fmt.Errorf("%w: UnverifiedCacheSize (%d)", errNegativeCacheSize, c.UnverifiedCacheSize)
+	case c.BytesToIDCacheSize < 0:
+		return fmt.Errorf("%w: BytesToIDCacheSize (%d)", errNegativeCacheSize, c.BytesToIDCacheSize)
+	case c.HeightIndexCacheSize < 0:
+		return fmt.Errorf("%w: HeightIndexCacheSize (%d)", errNegativeCacheSize, c.HeightIndexCacheSize)
+	case c.FailedVerifyCacheSize < 0:
+		return fmt.Errorf("%w: FailedVerifyCacheSize (%d)", errNegativeCacheSize, c.FailedVerifyCacheSize)
+	case c.MaxPendingBlocks < 0:
+		return fmt.Errorf("%w: MaxPendingBlocks (%d)", errNegativeMaxPendingBlocks, c.MaxPendingBlocks)
+	case c.AcceptedChSize < 0:
+		return fmt.Errorf("%w: AcceptedChSize (%d)", errNegativeAcceptedChSize, c.AcceptedChSize)
+	case c.ChildrenIndexDepth < 0:
+		return fmt.Errorf("%w: ChildrenIndexDepth (%d)", errNegativeChildrenIndexDepth, c.ChildrenIndexDepth)
+	case c.UnverifiedTTL < 0:
+		return fmt.Errorf("%w: UnverifiedTTL (%s)", errNegativeTTL, c.UnverifiedTTL)
+	case c.DecisionTimeout < 0:
+		return fmt.Errorf("%w: DecisionTimeout (%s)", errNegativeTimeout, c.DecisionTimeout)
+	case c.VerifyRetryBackoff < 0:
+		return fmt.Errorf("%w: VerifyRetryBackoff (%s)", errNegativeTimeout, c.VerifyRetryBackoff)
+	case c.MaxVerifyRetries < 0:
+		return fmt.Errorf("%w: MaxVerifyRetries (%d)", errNegativeMaxVerifyRetries, c.MaxVerifyRetries)
+	case c.MaxProcessing < 0:
+		return fmt.Errorf("%w: MaxProcessing (%d)", errNegativeMaxProcessing, c.MaxProcessing)
+	case c.MaxConcurrentVerify < 0:
+		return fmt.Errorf("%w: MaxConcurrentVerify (%d)", errNegativeMaxConcurrentVerify, c.MaxConcurrentVerify)
+	default:
+		return nil
+	}
+}
+
+// withDefaults verifies [c] and returns a copy of it with all unset cache
+// sizes replaced by their defaults.
+func (c *Config) withDefaults() (*Config, error) {
+	if err := c.Verify(); err != nil {
+		return nil, err
+	}
+
+	config := *c
+	if config.DecidedCacheSize == 0 {
+		config.DecidedCacheSize = DefaultDecidedCacheSize
+	}
+	if config.MissingCacheSize == 0 {
+		config.MissingCacheSize = DefaultMissingCacheSize
+	}
+	if config.UnverifiedCacheSize == 0 {
+		config.UnverifiedCacheSize = DefaultUnverifiedCacheSize
+	}
+	if config.BytesToIDCacheSize == 0 {
+		config.BytesToIDCacheSize = DefaultBytesToIDCacheSize
+	}
+	if config.HeightIndexCacheSize == 0 {
+		config.HeightIndexCacheSize = DefaultHeightIndexCacheSize
+	}
+	if config.FailedVerifyCacheSize == 0 {
+		config.FailedVerifyCacheSize = DefaultFailedVerifyCacheSize
+	}
+	if config.AcceptedChSize == 0 {
+		config.AcceptedChSize = DefaultAcceptedChSize
+	}
+	if config.VerifyRetryBackoff == 0 {
+		config.VerifyRetryBackoff = DefaultVerifyRetryBackoff
+	}
+	if config.DisableDecidedCache {
+		config.DecidedEvictionPolicy = disabledPolicy{}
+	} else if config.DecidedEvictionPolicy == nil {
+		config.DecidedEvictionPolicy = LRUPolicy{}
+	}
+	if config.VerifiedMap == nil {
+		config.VerifiedMap = PlainMap{}
+	}
+	return &config, nil
+}
@@ -0,0 +1,194 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigWithDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expected    Config
+		expectedErr error
+	}{
+		{
+			name:   "all defaults",
+			config: Config{},
+			expected: Config{
+				DecidedCacheSize:    DefaultDecidedCacheSize,
+				MissingCacheSize:    DefaultMissingCacheSize,
+				UnverifiedCacheSize: DefaultUnverifiedCacheSize,
+				BytesToIDCacheSize:  DefaultBytesToIDCacheSize,
+
+				HeightIndexCacheSize:  DefaultHeightIndexCacheSize,
+				FailedVerifyCacheSize: DefaultFailedVerifyCacheSize,
+				AcceptedChSize:        DefaultAcceptedChSize,
+				VerifyRetryBackoff:    DefaultVerifyRetryBackoff,
+
+				DecidedEvictionPolicy: LRUPolicy{},
+				VerifiedMap:           PlainMap{},
+			},
+		},
+		{
+			name: "explicit sizes",
+			config: Config{
+				DecidedCacheSize:    1,
+				MissingCacheSize:    2,
+				UnverifiedCacheSize: 3,
+				BytesToIDCacheSize:  4,
+
+				HeightIndexCacheSize:  5,
+				FailedVerifyCacheSize: 6,
+				AcceptedChSize:        7,
+				VerifyRetryBackoff:    8,
+
+				DecidedEvictionPolicy: NoEvictionPolicy{},
+				VerifiedMap:           ShardedMap{Shards: 4},
+			},
+			expected: Config{
+				DecidedCacheSize:    1,
+				MissingCacheSize:    2,
+				UnverifiedCacheSize: 3,
+				BytesToIDCacheSize:  4,
+
+				HeightIndexCacheSize:  5,
+				FailedVerifyCacheSize: 6,
+				AcceptedChSize:        7,
+				VerifyRetryBackoff:    8,
+
+				DecidedEvictionPolicy: NoEvictionPolicy{},
+				VerifiedMap:           ShardedMap{Shards: 4},
+			},
+		},
+		{
+			name: "disabled decided cache",
+			config: Config{
+				DecidedEvictionPolicy: NoEvictionPolicy{},
+				DisableDecidedCache:   true,
+			},
+			expected: Config{
+				DecidedCacheSize:    DefaultDecidedCacheSize,
+				MissingCacheSize:    DefaultMissingCacheSize,
+				UnverifiedCacheSize: DefaultUnverifiedCacheSize,
+				BytesToIDCacheSize:  DefaultBytesToIDCacheSize,
+
+				HeightIndexCacheSize:  DefaultHeightIndexCacheSize,
+				FailedVerifyCacheSize: DefaultFailedVerifyCacheSize,
+				AcceptedChSize:        DefaultAcceptedChSize,
+				VerifyRetryBackoff:    DefaultVerifyRetryBackoff,
+
+				DecidedEvictionPolicy: disabledPolicy{},
+				DisableDecidedCache:   true,
+				VerifiedMap:           PlainMap{},
+			},
+		},
+		{
+			name: "negative accepted channel size",
+			config: Config{
+				AcceptedChSize: -1,
+			},
+			expectedErr: errNegativeAcceptedChSize,
+		},
+		{
+			name: "negative decided cache size",
+			config: Config{
+				DecidedCacheSize: -1,
+			},
+			expectedErr: errNegativeCacheSize,
+		},
+		{
+			name: "negative missing cache size",
+			config: Config{
+				MissingCacheSize: -1,
+			},
+			expectedErr: errNegativeCacheSize,
+		},
+		{
+			name: "negative unverified cache size",
+			config: Config{
+				UnverifiedCacheSize: -1,
+			},
+			expectedErr: errNegativeCacheSize,
+		},
+		{
+			name: "negative bytes to ID cache size",
+			config: Config{
+				BytesToIDCacheSize: -1,
+			},
+			expectedErr: errNegativeCacheSize,
+		},
+		{
+			name: "negative failed verify cache size",
+			config: Config{
+				FailedVerifyCacheSize: -1,
+			},
+			expectedErr: errNegativeCacheSize,
+		},
+		{
+			name: "negative max pending blocks",
+			config: Config{
+				MaxPendingBlocks: -1,
+			},
+			expectedErr: errNegativeMaxPendingBlocks,
+		},
+		{
+			name: "negative children index depth",
+			config: Config{
+				ChildrenIndexDepth: -1,
+			},
+			expectedErr: errNegativeChildrenIndexDepth,
+		},
+		{
+			name: "negative decision timeout",
+			config: Config{
+				DecisionTimeout: -1,
+			},
+			expectedErr: errNegativeTimeout,
+		},
+		{
+			name: "negative max processing",
+			config: Config{
+				MaxProcessing: -1,
+			},
+			expectedErr: errNegativeMaxProcessing,
+		},
+		{
+			name: "negative max concurrent verify",
+			config: Config{
+				MaxConcurrentVerify: -1,
+			},
+			expectedErr: errNegativeMaxConcurrentVerify,
+		},
+		{
+			name: "negative verify retry backoff",
+			config: Config{
+				VerifyRetryBackoff: -1,
+			},
+			expectedErr: errNegativeTimeout,
+		},
+		{
+			name: "negative max verify retries",
+			config: Config{
+				MaxVerifyRetries: -1,
+			},
+			expectedErr: errNegativeMaxVerifyRetries,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			config, err := test.config.withDefaults()
+			require.ErrorIs(err, test.expectedErr)
+			if test.expectedErr != nil {
+				return
+			}
+			require.Equal(test.expected, *config)
+		})
+	}
+}
@@ -0,0 +1,593 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/luxfi/cache"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/utils"
+	"github.com/luxfi/utils/linked"
+)
+
+var (
+	_ EvictionPolicy = LRUPolicy{}
+	_ EvictionPolicy = TTLPolicy{}
+	_ EvictionPolicy = NoEvictionPolicy{}
+	_ EvictionPolicy = disabledPolicy{}
+
+	_ enumerableCache[struct{}, struct{}] = (*lruCache[struct{}, struct{}])(nil)
+	_ enumerableCache[struct{}, struct{}] = (*ttlCache[struct{}, struct{}])(nil)
+	_ enumerableCache[struct{}, struct{}] = (*unboundedCache[struct{}, struct{}])(nil)
+	_ enumerableCache[struct{}, struct{}] = emptyCache[struct{}, struct{}]{}
+)
+
+// enumerableCache is a cache whose entries can be enumerated.
+type enumerableCache[K comparable, V any] interface {
+	cache.Cacher[K, V]
+
+	// each calls [f] with every entry in the cache. [f] must not call into the
+	// cache.
+	each(f func(K, V))
+}
+
+// EvictionPolicy determines when decided blocks are evicted from State.
+type EvictionPolicy interface {
+	// newCache returns the cache of decided blocks, given the configured
+	// [Config.DecidedCacheSize]. If non-nil, [onEvict] must be called, without
+	// holding any lock, with every block the cache evicts on its own.
+	newCache(size int, onEvict func(ids.ID, decidedBlock)) enumerableCache[ids.ID, decidedBlock]
+}
+
+// LRUPolicy evicts the least recently used decided blocks once their
+// cumulative size exceeds [Config.DecidedCacheSize]. This is the default
+// policy.
+type LRUPolicy struct{}
+
+func (LRUPolicy) newCache(size int, onEvict func(ids.ID, decidedBlock)) enumerableCache[ids.ID, decidedBlock] {
+	return newLRUCache(size, cachedDecidedBlockSize, onEvict)
+}
+
+// TTLPolicy evicts decided blocks that have not been accessed within [TTL].
+// Expired blocks are evicted on every Put and are never returned by Get.
+//
+// [Config.DecidedCacheSize] does not bound the cache under this policy. It is
+// only used to report how full the cache is, which may exceed 1.
+type TTLPolicy struct {
+	TTL time.Duration
+
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+func (p TTLPolicy) newCache(size int, onEvict func(ids.ID, decidedBlock)) enumerableCache[ids.ID, decidedBlock] {
+	now := p.now
+	if now == nil {
+		now = time.Now
+	}
+	return newTTLCache(p.TTL, now, size, cachedDecidedBlockSize, onEvict)
+}
+
+// NoEvictionPolicy never evicts decided blocks. This is intended for archival
+// VMs that are able to hold their entire history in memory.
+//
+// [Config.DecidedCacheSize] does not bound the cache under this policy. It is
+// only used to report how full the cache is, which may exceed 1.
+type NoEvictionPolicy struct{}
+
+func (NoEvictionPolicy) newCache(size int, _ func(ids.ID, decidedBlock)) enumerableCache[ids.ID, decidedBlock] {
+	return newUnboundedCache(size, cachedDecidedBlockSize)
+}
+
+// disabledPolicy caches no decided blocks. It is selected by
+// [Config.DisableDecidedCache].
+type disabledPolicy struct{}
+
+func (disabledPolicy) newCache(int, func(ids.ID, decidedBlock)) enumerableCache[ids.ID, decidedBlock] {
+	return emptyCache[ids.ID, decidedBlock]{}
+}
+
+// evictedEntry is an entry that was evicted by a cache.
+type evictedEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// notifyEvicted calls [onEvict], if non-nil, with each of the [evicted]
+// entries. It must be called without holding the cache's lock, so that
+// [onEvict] is free to access the cache.
+func notifyEvicted[K comparable, V any](onEvict func(K, V), evicted []evictedEntry[K, V]) {
+	if onEvict == nil {
+		return
+	}
+	for _, e := range evicted {
+		onEvict(e.key, e.value)
+	}
+}
+
+type lruElement[V any] struct {
+	value    V
+	size     int
+	inserted time.Time
+}
+
+// lruCache is a key value store bounded by the cumulative size of its
+// entries. When an entry is added, the least recently used entries are
+// evicted until the cache fits in [maxSize]. Unlike lru.SizedCache, it
+// reports the entries it evicts to [onEvict].
+//
+// If [ttl] is non-zero, entries are also evicted once they were inserted more
+// than [ttl] ago. Expired entries are never returned by Get, and are removed by
+// [expire].
+type lruCache[K comparable, V any] struct {
+	lock sync.Mutex
+	// elements is ordered from least to most recently used.
+	elements    *linked.Hashmap[K, *lruElement[V]]
+	maxSize     int
+	currentSize int
+	size        func(K, V) int
+	onEvict     func(K, V)
+
+	ttl time.Duration
+	now func() time.Time
+}
+
+func newLRUCache[K comparable, V any](
+	maxSize int,
+	size func(K, V) int,
+	onEvict func(K, V),
+) *lruCache[K, V] {
+	return newExpiringLRUCache(maxSize, size, onEvict, 0, time.Now)
+}
+
+func newExpiringLRUCache[K comparable, V any](
+	maxSize int,
+	size func(K, V) int,
+	onEvict func(K, V),
+	ttl time.Duration,
+	now func() time.Time,
+) *lruCache[K, V] {
+	return &lruCache[K, V]{
+		elements: linked.NewHashmap[K, *lruElement[V]](),
+		maxSize:  maxSize,
+		size:     size,
+		onEvict:  onEvict,
+		ttl:      ttl,
+		now:      now,
+	}
+}
+
+func (c *lruCache[K, V]) Put(key K, value V) {
+	c.lock.Lock()
+	evicted := c.put(key, value)
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+}
+
+func (c *lruCache[K, V]) put(key K, value V) []evictedEntry[K, V] {
+	c.evict(key)
+
+	element := &lruElement[V]{
+		value: value,
+		size:  c.size(key, value),
+	}
+	if c.ttl != 0 {
+		element.inserted = c.now()
+	}
+	var evictedEntries []evictedEntry[K, V]
+	if element.size > c.maxSize {
+		// The entry can never fit in the cache.
+		return append(c.flush(), evictedEntry[K, V]{key: key, value: value})
+	}
+	for c.currentSize > c.maxSize-element.size {
+		oldestKey, oldestElement, _ := c.elements.Oldest()
+		c.elements.Delete(oldestKey)
+		c.currentSize -= oldestElement.size
+		evictedEntries = append(evictedEntries, evictedEntry[K, V]{
+			key:   oldestKey,
+			value: oldestElement.value,
+		})
+	}
+
+	c.elements.Put(key, element)
+	c.currentSize += element.size
+	return evictedEntries
+}
+
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	element, ok := c.elements.Get(key)
+	if !ok {
+		c.lock.Unlock()
+		return utils.Zero[V](), false
+	}
+	// The clock is only read if entries expire, to keep lookups cheap.
+	if c.ttl != 0 && c.expired(element, c.now()) {
+		c.evict(key)
+		c.lock.Unlock()
+
+		notifyEvicted(c.onEvict, []evictedEntry[K, V]{{key: key, value: element.value}})
+		return utils.Zero[V](), false
+	}
+	c.elements.Put(key, element) // Mark [key] as most recently used.
+	c.lock.Unlock()
+	return element.value, true
+}
+
+func (c *lruCache[K, _]) Evict(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.evict(key)
+}
+
+func (c *lruCache[_, _]) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.elements.Clear()
+	c.currentSize = 0
+}
+
+func (c *lruCache[_, _]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.elements.Len()
+}
+
+func (c *lruCache[_, _]) PortionFilled() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return float64(c.currentSize) / float64(c.maxSize)
+}
+
+func (c *lruCache[K, V]) each(f func(K, V)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for iter := c.elements.NewIterator(); iter.Next(); {
+		f(iter.Key(), iter.Value().value)
+	}
+}
+
+func (c *lruCache[K, _]) evict(key K) {
+	if element, ok := c.elements.Get(key); ok {
+		c.elements.Delete(key)
+		c.currentSize -= element.size
+	}
+}
+
+// expire evicts all the expired entries. As entries are ordered by use rather
+// than insertion, every entry is checked.
+func (c *lruCache[K, V]) expire() {
+	if c.ttl == 0 {
+		return
+	}
+
+	c.lock.Lock()
+	var (
+		now     = c.now()
+		expired []evictedEntry[K, V]
+	)
+	for iter := c.elements.NewIterator(); iter.Next(); {
+		if element := iter.Value(); c.expired(element, now) {
+			expired = append(expired, evictedEntry[K, V]{
+				key:   iter.Key(),
+				value: element.value,
+			})
+		}
+	}
+	for _, e := range expired {
+		c.evict(e.key)
+	}
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, expired)
+}
+
+func (c *lruCache[_, V]) expired(element *lruElement[V], now time.Time) bool {
+	return c.ttl != 0 && now.Sub(element.inserted) > c.ttl
+}
+
+// flush removes all the elements and returns them as evicted.
+func (c *lruCache[K, V]) flush() []evictedEntry[K, V] {
+	evictedEntries := make([]evictedEntry[K, V], 0, c.elements.Len())
+	for iter := c.elements.NewIterator(); iter.Next(); {
+		evictedEntries = append(evictedEntries, evictedEntry[K, V]{
+			key:   iter.Key(),
+			value: iter.Value().value,
+		})
+	}
+	c.elements.Clear()
+	c.currentSize = 0
+	return evictedEntries
+}
+
+type ttlElement[V any] struct {
+	value      V
+	size       int
+	lastAccess time.Time
+}
+
+// ttlCache is a key value store that evicts entries that have not been
+// accessed within [ttl].
+type ttlCache[K comparable, V any] struct {
+	lock sync.Mutex
+	// elements is ordered from least to most recently accessed.
+	elements *linked.Hashmap[K, *ttlElement[V]]
+	ttl      time.Duration
+	now      func() time.Time
+
+	// nominalSize is only used to report the portion of the cache filled.
+	nominalSize int
+	currentSize int
+	size        func(K, V) int
+	// onEvict, if non-nil, is called with every expired entry.
+	onEvict func(K, V)
+}
+
+func newTTLCache[K comparable, V any](
+	ttl time.Duration,
+	now func() time.Time,
+	nominalSize int,
+	size func(K, V) int,
+	onEvict func(K, V),
+) *ttlCache[K, V] {
+	return &ttlCache[K, V]{
+		elements:    linked.NewHashmap[K, *ttlElement[V]](),
+		ttl:         ttl,
+		now:         now,
+		nominalSize: nominalSize,
+		size:        size,
+		onEvict:     onEvict,
+	}
+}
+
+func (c *ttlCache[K, V]) Put(key K, value V) {
+	c.lock.Lock()
+	evicted := c.put(key, value)
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+}
+
+func (c *ttlCache[K, V]) put(key K, value V) []evictedEntry[K, V] {
+	now := c.now()
+	expired := c.expire(now)
+	c.evict(key)
+
+	element := &ttlElement[V]{
+		value:      value,
+		size:       c.size(key, value),
+		lastAccess: now,
+	}
+	c.elements.Put(key, element)
+	c.currentSize += element.size
+	return expired
+}
+
+func (c *ttlCache[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	value, ok, expired := c.get(key)
+	c.lock.Unlock()
+
+	if expired {
+		notifyEvicted(c.onEvict, []evictedEntry[K, V]{{key: key, value: value}})
+		return utils.Zero[V](), false
+	}
+	return value, ok
+}
+
+// get returns the value of [key], if it is present and has not expired.
+// Returns true as the third value if [key] was evicted because it expired.
+func (c *ttlCache[K, V]) get(key K) (V, bool, bool) {
+	element, ok := c.elements.Get(key)
+	if !ok {
+		return utils.Zero[V](), false, false
+	}
+
+	now := c.now()
+	if c.expired(element, now) {
+		c.evict(key)
+		return element.value, false, true
+	}
+
+	element.lastAccess = now
+	c.elements.Put(key, element) // Mark [key] as most recently accessed.
+	return element.value, true, false
+}
+
+func (c *ttlCache[K, _]) Evict(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.evict(key)
+}
+
+func (c *ttlCache[_, _]) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.elements.Clear()
+	c.currentSize = 0
+}
+
+func (c *ttlCache[_, _]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.elements.Len()
+}
+
+// PortionFilled returns the cumulative size of the entries relative to the
+// nominal size of the cache. As the cache is not bounded by size, this may
+// exceed 1.
+func (c *ttlCache[_, _]) PortionFilled() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return float64(c.currentSize) / float64(c.nominalSize)
+}
+
+func (c *ttlCache[K, V]) each(f func(K, V)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for iter := c.elements.NewIterator(); iter.Next(); {
+		f(iter.Key(), iter.Value().value)
+	}
+}
+
+func (c *ttlCache[K, _]) evict(key K) {
+	if element, ok := c.elements.Get(key); ok {
+		c.elements.Delete(key)
+		c.currentSize -= element.size
+	}
+}
+
+// expire removes and returns all the elements whose last access was more than
+// [c.ttl] before [now].
+func (c *ttlCache[K, V]) expire(now time.Time) []evictedEntry[K, V] {
+	var expired []evictedEntry[K, V]
+	for {
+		oldestKey, oldestElement, ok := c.elements.Oldest()
+		if !ok || !c.expired(oldestElement, now) {
+			return expired
+		}
+		c.elements.Delete(oldestKey)
+		c.currentSize -= oldestElement.size
+		expired = append(expired, evictedEntry[K, V]{
+			key:   oldestKey,
+			value: oldestElement.value,
+		})
+	}
+}
+
+func (c *ttlCache[_, V]) expired(element *ttlElement[V], now time.Time) bool {
+	return now.Sub(element.lastAccess) > c.ttl
+}
+
+// unboundedCache is a key value store that never evicts entries on its own.
+type unboundedCache[K comparable, V any] struct {
+	lock     sync.Mutex
+	elements map[K]*sizedValue[V]
+
+	// nominalSize is only used to report the portion of the cache filled.
+	nominalSize int
+	currentSize int
+	size        func(K, V) int
+}
+
+type sizedValue[V any] struct {
+	value V
+	size  int
+}
+
+func newUnboundedCache[K comparable, V any](nominalSize int, size func(K, V) int) *unboundedCache[K, V] {
+	return &unboundedCache[K, V]{
+		elements:    make(map[K]*sizedValue[V]),
+		nominalSize: nominalSize,
+		size:        size,
+	}
+}
+
+func (c *unboundedCache[K, V]) Put(key K, value V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.evict(key)
+	element := &sizedValue[V]{
+		value: value,
+		size:  c.size(key, value),
+	}
+	c.elements[key] = element
+	c.currentSize += element.size
+}
+
+func (c *unboundedCache[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.elements[key]
+	if !ok {
+		return utils.Zero[V](), false
+	}
+	return element.value, true
+}
+
+func (c *unboundedCache[K, _]) Evict(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.evict(key)
+}
+
+func (c *unboundedCache[_, _]) Flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	clear(c.elements)
+	c.currentSize = 0
+}
+
+func (c *unboundedCache[_, _]) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.elements)
+}
+
+// PortionFilled returns the cumulative size of the entries relative to the
+// nominal size of the cache. As the cache is not bounded by size, this may
+// exceed 1.
+func (c *unboundedCache[_, _]) PortionFilled() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return float64(c.currentSize) / float64(c.nominalSize)
+}
+
+func (c *unboundedCache[K, V]) each(f func(K, V)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, element := range c.elements {
+		f(key, element.value)
+	}
+}
+
+func (c *unboundedCache[K, _]) evict(key K) {
+	if element, ok := c.elements[key]; ok {
+		delete(c.elements, key)
+		c.currentSize -= element.size
+	}
+}
+
+// emptyCache is a cache that never holds any entry.
+type emptyCache[K comparable, V any] struct{}
+
+func (emptyCache[K, V]) Put(K, V) {}
+
+func (emptyCache[K, V]) Get(K) (V, bool) {
+	return utils.Zero[V](), false
+}
+
+func (emptyCache[K, _]) Evict(K) {}
+
+func (emptyCache[_, _]) Flush() {}
+
+func (emptyCache[_, _]) Len() int {
+	return 0
+}
+
+func (emptyCache[_, _]) PortionFilled() float64 {
+	return 0
+}
+
+func (emptyCache[K, V]) each(func(K, V)) {}
@@ -0,0 +1,193 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/database"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+type testClock struct {
+	time time.Time
+}
+
+func (c *testClock) now() time.Time {
+	return c.time
+}
+
+func TestTTLCache(t *testing.T) {
+	require := require.New(t)
+
+	clock := &testClock{time: time.Unix(0, 0)}
+	var expired []int
+	c := newTTLCache(time.Minute, clock.now, 10, func(int, int) int { return 1 }, func(key int, _ int) {
+		expired = append(expired, key)
+	})
+
+	c.Put(1, 1)
+	clock.time = clock.time.Add(30 * time.Second)
+	c.Put(2, 2)
+
+	// Accessing [1] refreshes it.
+	clock.time = clock.time.Add(15 * time.Second)
+	value, ok := c.Get(1)
+	require.True(ok)
+	require.Equal(1, value)
+
+	// [2] was last accessed more than a minute ago and is evicted by the Put.
+	clock.time = clock.time.Add(55 * time.Second)
+	c.Put(3, 3)
+	require.Equal(2, c.Len())
+	require.InDelta(0.2, c.PortionFilled(), 0.001)
+	_, ok = c.Get(2)
+	require.False(ok)
+	require.Equal([]int{2}, expired)
+
+	// Expired entries are never returned, even before the next Put.
+	clock.time = clock.time.Add(2 * time.Minute)
+	_, ok = c.Get(1)
+	require.False(ok)
+	_, ok = c.Get(3)
+	require.False(ok)
+	require.Equal([]int{2, 1, 3}, expired)
+}
+
+func TestLRUCache(t *testing.T) {
+	require := require.New(t)
+
+	var evicted []int
+	c := newLRUCache(3, func(_ int, value int) int { return value }, func(key int, _ int) {
+		evicted = append(evicted, key)
+	})
+
+	c.Put(1, 1)
+	c.Put(2, 1)
+	c.Put(3, 1)
+	require.InDelta(1, c.PortionFilled(), 0.001)
+
+	// Accessing [1] makes [2] the least recently used.
+	_, ok := c.Get(1)
+	require.True(ok)
+	c.Put(4, 1)
+	require.Equal([]int{2}, evicted)
+	_, ok = c.Get(2)
+	require.False(ok)
+
+	// Explicit evictions are not reported.
+	c.Evict(3)
+	require.Equal([]int{2}, evicted)
+	require.Equal(2, c.Len())
+
+	// Entries that can never fit flush the cache.
+	c.Put(5, 4)
+	require.Equal([]int{2, 1, 4, 5}, evicted)
+	require.Zero(c.Len())
+}
+
+func TestLRUCacheWithoutTTLDoesNotReadClock(t *testing.T) {
+	require := require.New(t)
+
+	c := newExpiringLRUCache(3, func(int, int) int { return 1 }, nil, 0, func() time.Time {
+		require.FailNow("clock read without a ttl")
+		return time.Time{}
+	})
+	c.Put(1, 1)
+	_, ok := c.Get(1)
+	require.True(ok)
+}
+
+func TestExpiringLRUCache(t *testing.T) {
+	require := require.New(t)
+
+	clock := &testClock{time: time.Unix(0, 0)}
+	var evicted []int
+	c := newExpiringLRUCache(10, func(int, int) int { return 1 }, func(key int, _ int) {
+		evicted = append(evicted, key)
+	}, time.Minute, clock.now)
+
+	c.Put(1, 1)
+	clock.time = clock.time.Add(30 * time.Second)
+	c.Put(2, 2)
+
+	// Unlike [ttlCache], accessing an entry doesn't refresh it.
+	clock.time = clock.time.Add(15 * time.Second)
+	_, ok := c.Get(1)
+	require.True(ok)
+
+	clock.time = clock.time.Add(30 * time.Second)
+	_, ok = c.Get(1)
+	require.False(ok)
+	require.Equal([]int{1}, evicted)
+
+	c.Put(3, 3)
+	clock.time = clock.time.Add(2 * time.Minute)
+	c.expire()
+	require.Equal([]int{1, 2, 3}, evicted)
+	require.Zero(c.Len())
+}
+
+func TestDecidedBlocksSurviveReorgWithinTTL(t *testing.T) {
+	require := require.New(t)
+
+	clock := &testClock{time: time.Unix(0, 0)}
+	genesis := chaintest.NewGenesis()
+	preferred := chaintest.NewBlock(genesis)
+	conflicting := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{
+		preferred.ID():   preferred,
+		conflicting.ID(): conflicting,
+	}
+	config := newTestConfig(genesis, blks)
+	config.DecidedEvictionPolicy = TTLPolicy{
+		TTL: time.Minute,
+		now: clock.now,
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	preferredBlk, err := state.GetBlock(ctx, preferred.ID())
+	require.NoError(err)
+	conflictingBlk, err := state.GetBlock(ctx, conflicting.ID())
+	require.NoError(err)
+	require.NoError(preferredBlk.Verify(ctx))
+	require.NoError(conflictingBlk.Verify(ctx))
+	require.NoError(preferredBlk.Accept(ctx))
+	require.NoError(conflictingBlk.Reject(ctx))
+
+	// Within the TTL both sides of the fork are served from the cache without
+	// consulting the VM.
+	delete(blks, preferred.ID())
+	delete(blks, conflicting.ID())
+	clock.time = clock.time.Add(30 * time.Second)
+	blk, err := state.GetBlock(ctx, preferred.ID())
+	require.NoError(err)
+	require.Same(preferredBlk, blk)
+	blk, err = state.GetBlock(ctx, conflicting.ID())
+	require.NoError(err)
+	require.Same(conflictingBlk, blk)
+
+	// Once the TTL elapses the decided blocks are evicted.
+	clock.time = clock.time.Add(2 * time.Minute)
+	_, err = state.GetBlock(ctx, conflicting.ID())
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestNoEvictionPolicy(t *testing.T) {
+	require := require.New(t)
+
+	c := NoEvictionPolicy{}.newCache(1, nil)
+	genesis := chaintest.NewGenesis()
+	for range 100 {
+		blk := chaintest.NewBlock(genesis)
+		c.Put(blk.ID(), decidedBlock{BlockWrapper: &BlockWrapper{Block: blk}})
+	}
+	require.Equal(100, c.Len())
+}
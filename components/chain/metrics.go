@@ -0,0 +1,347 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/luxfi/cache"
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/metric"
+)
+
+const (
+	metricsNamespace      = "chain_state"
+	blockMetricsNamespace = "chain_block"
+	chainMetricsNamespace = "chain"
+
+	contextLabel = "context"
+
+	cacheLabel      = "cache"
+	verifiedLabel   = "verified"
+	decidedLabel    = "decided"
+	unverifiedLabel = "unverified"
+)
+
+var (
+	_ cache.Cacher[struct{}, struct{}] = (*bytesMeteredCache[struct{}, struct{}])(nil)
+
+	cacheLabels   = []string{cacheLabel}
+	contextLabels = []string{contextLabel}
+)
+
+// cacheMetrics tracks the lookups performed against a single block cache.
+type cacheMetrics struct {
+	hits   metric.Counter
+	misses metric.Counter
+
+	// numHits and numMisses mirror [hits] and [misses] for [State.Stats], as
+	// the registered counters can't be read back.
+	numHits   atomic.Uint64
+	numMisses atomic.Uint64
+}
+
+func (c *cacheMetrics) observe(hit bool) {
+	if hit {
+		c.hits.Inc()
+		c.numHits.Add(1)
+	} else {
+		c.misses.Inc()
+		c.numMisses.Add(1)
+	}
+}
+
+// stateMetrics is the optional metrics surface of State. A nil *stateMetrics
+// is valid and records nothing, so un-metered states pay no overhead.
+type stateMetrics struct {
+	verified   cacheMetrics
+	decided    cacheMetrics
+	unverified cacheMetrics
+
+	processing metric.Gauge
+	pending    metric.Gauge
+	// liveWrappers is the number of wrappers created for undecided blocks
+	// minus the number of those wrappers that were decided. Wrappers dropped
+	// from the unverified cache remain counted, so a steady climb reveals
+	// blocks that are never decided.
+	liveWrappers metric.Gauge
+
+	// cacheBytes and cacheMaxBytes report the estimated usage and the budget
+	// of the byte-bounded block caches.
+	cacheBytes    metric.GaugeVec
+	cacheMaxBytes metric.GaugeVec
+
+	verifyDuration            metric.Histogram
+	verifyWithContextDuration metric.Histogram
+	verifyContextFallbacks    metric.Counter
+
+	decidedStoreErrors metric.Counter
+
+	reorgDepth        metric.Histogram
+	reorgDepthUnknown metric.Counter
+
+	lastAcceptedHeight    metric.Gauge
+	lastAcceptedTimestamp metric.Gauge
+}
+
+func newStateMetrics(registerer metric.Registerer) (*stateMetrics, error) {
+	hits := metric.NewCounterVec(
+		metric.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_hits",
+			Help:      "number of block lookups that were served by the cache",
+		},
+		cacheLabels,
+	)
+	misses := metric.NewCounterVec(
+		metric.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_misses",
+			Help:      "number of block lookups that were not served by the cache",
+		},
+		cacheLabels,
+	)
+	verifyDuration := metric.NewHistogramVec(
+		metric.HistogramOpts{
+			Namespace: blockMetricsNamespace,
+			Name:      "verify_duration_seconds",
+			Help:      "time spent verifying blocks, labeled by whether a block context was used",
+		},
+		contextLabels,
+	)
+	m := &stateMetrics{
+		verified: cacheMetrics{
+			hits:   hits.WithLabelValues(verifiedLabel),
+			misses: misses.WithLabelValues(verifiedLabel),
+		},
+		decided: cacheMetrics{
+			hits:   hits.WithLabelValues(decidedLabel),
+			misses: misses.WithLabelValues(decidedLabel),
+		},
+		unverified: cacheMetrics{
+			hits:   hits.WithLabelValues(unverifiedLabel),
+			misses: misses.WithLabelValues(unverifiedLabel),
+		},
+		processing: metric.NewGauge(metric.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "verified_blocks",
+			Help:      "number of verified blocks currently processing in consensus",
+		}),
+		pending: metric.NewGauge(metric.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "pending_blocks",
+			Help:      "number of blocks waiting for their parent to be verified or accepted",
+		}),
+		liveWrappers: metric.NewGauge(metric.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "live_wrappers",
+			Help:      "number of wrappers created for undecided blocks that have not been decided",
+		}),
+		cacheBytes: metric.NewGaugeVec(
+			metric.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "cache_bytes",
+				Help:      "estimated number of bytes held by the cache",
+			},
+			cacheLabels,
+		),
+		cacheMaxBytes: metric.NewGaugeVec(
+			metric.GaugeOpts{
+				Namespace: metricsNamespace,
+				Name:      "cache_max_bytes",
+				Help:      "configured byte budget of the cache",
+			},
+			cacheLabels,
+		),
+		verifyDuration:            verifyDuration.WithLabelValues(strconv.FormatBool(false)),
+		verifyWithContextDuration: verifyDuration.WithLabelValues(strconv.FormatBool(true)),
+		verifyContextFallbacks: metric.NewCounter(metric.CounterOpts{
+			Namespace: blockMetricsNamespace,
+			Name:      "verify_context_fallbacks",
+			Help:      "number of VerifyWithContext calls on blocks not implementing WithVerifyContext",
+		}),
+		decidedStoreErrors: metric.NewCounter(metric.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "decided_store_errors",
+			Help:      "number of failed reads from or writes to the decided store",
+		}),
+		reorgDepth: metric.NewHistogram(metric.HistogramOpts{
+			Namespace: chainMetricsNamespace,
+			Name:      "reorg_depth",
+			Help:      "number of accepted blocks that were reorged out of the accepted chain",
+			Buckets:   []float64{1, 2, 3, 4, 5, 10, 20, 50, 100},
+		}),
+		reorgDepthUnknown: metric.NewCounter(metric.CounterOpts{
+			Namespace: chainMetricsNamespace,
+			Name:      "reorg_depth_unknown",
+			Help:      "number of reorgs whose depth could not be determined from the cached blocks",
+		}),
+		lastAcceptedHeight: metric.NewGauge(metric.GaugeOpts{
+			Namespace: chainMetricsNamespace,
+			Name:      "last_accepted_height",
+			Help:      "height of the last accepted block",
+		}),
+		lastAcceptedTimestamp: metric.NewGauge(metric.GaugeOpts{
+			Namespace: chainMetricsNamespace,
+			Name:      "last_accepted_timestamp",
+			Help:      "timestamp of the last accepted block, in seconds since the Unix epoch",
+		}),
+	}
+	err := errors.Join(
+		registerer.Register(hits),
+		registerer.Register(misses),
+		registerer.Register(m.processing),
+		registerer.Register(m.pending),
+		registerer.Register(m.liveWrappers),
+		registerer.Register(m.cacheBytes),
+		registerer.Register(m.cacheMaxBytes),
+		registerer.Register(verifyDuration),
+		registerer.Register(m.verifyContextFallbacks),
+		registerer.Register(m.decidedStoreErrors),
+		registerer.Register(m.reorgDepth),
+		registerer.Register(m.reorgDepthUnknown),
+		registerer.Register(m.lastAcceptedHeight),
+		registerer.Register(m.lastAcceptedTimestamp),
+	)
+	return m, err
+}
+
+func (m *stateMetrics) verifiedLookup(hit bool) {
+	if m != nil {
+		m.verified.observe(hit)
+	}
+}
+
+func (m *stateMetrics) decidedLookup(hit bool) {
+	if m != nil {
+		m.decided.observe(hit)
+	}
+}
+
+func (m *stateMetrics) unverifiedLookup(hit bool) {
+	if m != nil {
+		m.unverified.observe(hit)
+	}
+}
+
+func (m *stateMetrics) setProcessing(numProcessing int) {
+	if m != nil {
+		m.processing.Set(float64(numProcessing))
+	}
+}
+
+func (m *stateMetrics) setPending(numPending int) {
+	if m != nil {
+		m.pending.Set(float64(numPending))
+	}
+}
+
+func (m *stateMetrics) wrapperCreated() {
+	if m != nil {
+		m.liveWrappers.Inc()
+	}
+}
+
+func (m *stateMetrics) wrapperDecided() {
+	if m != nil {
+		m.liveWrappers.Dec()
+	}
+}
+
+func (m *stateMetrics) verifyContextFallback() {
+	if m != nil {
+		m.verifyContextFallbacks.Inc()
+	}
+}
+
+func (m *stateMetrics) decidedStoreError() {
+	if m != nil {
+		m.decidedStoreErrors.Inc()
+	}
+}
+
+func (m *stateMetrics) reorg(depth uint64, known bool) {
+	if m == nil {
+		return
+	}
+	if known {
+		m.reorgDepth.Observe(float64(depth))
+	} else {
+		m.reorgDepthUnknown.Inc()
+	}
+}
+
+func (m *stateMetrics) setLastAccepted(blk block.Block) {
+	if m != nil {
+		m.lastAcceptedHeight.Set(float64(blk.Height()))
+		m.lastAcceptedTimestamp.Set(float64(blk.Timestamp().Unix()))
+	}
+}
+
+func noop() {}
+
+// startVerify returns a function that records the time elapsed since
+// startVerify was called as the duration of a block verification.
+func (m *stateMetrics) startVerify(withContext bool) func() {
+	if m == nil {
+		return noop
+	}
+
+	histogram := m.verifyDuration
+	if withContext {
+		histogram = m.verifyWithContextDuration
+	}
+	start := time.Now()
+	return func() {
+		histogram.Observe(time.Since(start).Seconds())
+	}
+}
+
+// meterCacheBytes wraps [c], a cache with a budget of [maxBytes], so that its
+// usage is reported under [cacheName].
+func meterCacheBytes[K comparable, V any](
+	m *stateMetrics,
+	cacheName string,
+	maxBytes int,
+	c cache.Cacher[K, V],
+) cache.Cacher[K, V] {
+	m.cacheMaxBytes.WithLabelValues(cacheName).Set(float64(maxBytes))
+	return &bytesMeteredCache[K, V]{
+		Cacher:   c,
+		maxBytes: maxBytes,
+		bytes:    m.cacheBytes.WithLabelValues(cacheName),
+	}
+}
+
+// bytesMeteredCache reports the estimated number of bytes held by the wrapped
+// cache after every mutation. The estimate is derived from the portion of the
+// cache that is filled.
+type bytesMeteredCache[K comparable, V any] struct {
+	cache.Cacher[K, V]
+
+	maxBytes int
+	bytes    metric.Gauge
+}
+
+func (c *bytesMeteredCache[K, V]) Put(key K, value V) {
+	c.Cacher.Put(key, value)
+	c.update()
+}
+
+func (c *bytesMeteredCache[K, _]) Evict(key K) {
+	c.Cacher.Evict(key)
+	c.update()
+}
+
+func (c *bytesMeteredCache[_, _]) Flush() {
+	c.Cacher.Flush()
+	c.update()
+}
+
+func (c *bytesMeteredCache[_, _]) update() {
+	c.bytes.Set(c.Cacher.PortionFilled() * float64(c.maxBytes))
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/metric"
+	"github.com/luxfi/vms/components/chain/chaintest"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherMetric returns the metric [name] with the label [labelName] set to
+// [labelValue]. If [labelName] is empty, the first metric named [name] is
+// returned.
+func gatherMetric(t *testing.T, registry metric.Registry, name string, labelName string, labelValue string) *dto.Metric {
+	t.Helper()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if labelName == "" {
+				return m
+			}
+			for _, label := range m.GetLabel() {
+				if label.GetName() == labelName && label.GetValue() == labelValue {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func gatherCounter(t *testing.T, registry metric.Registry, name string, cacheName string) float64 {
+	t.Helper()
+
+	return gatherMetric(t, registry, name, cacheLabel, cacheName).GetCounter().GetValue()
+}
+
+func TestMeteredStateCacheHitsAndMisses(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	// The genesis block is served from the decided cache.
+	_, err = state.GetBlock(context.Background(), genesis.ID())
+	require.NoError(err)
+	require.Equal(1.0, gatherCounter(t, registry, "chain_state_cache_misses", verifiedLabel))
+	require.Equal(1.0, gatherCounter(t, registry, "chain_state_cache_hits", decidedLabel))
+
+	// An unknown block misses every cache.
+	_, err = state.GetBlock(context.Background(), ids.GenerateTestID())
+	require.ErrorIs(err, database.ErrNotFound)
+	require.Equal(2.0, gatherCounter(t, registry, "chain_state_cache_misses", verifiedLabel))
+	require.Equal(1.0, gatherCounter(t, registry, "chain_state_cache_misses", decidedLabel))
+	require.Equal(1.0, gatherCounter(t, registry, "chain_state_cache_misses", unverifiedLabel))
+}
+
+func TestMeteredStateVerifyDuration(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+
+	m := gatherMetric(t, registry, "chain_block_verify_duration_seconds", contextLabel, "false")
+	require.NotNil(m)
+	require.Equal(uint64(1), m.GetHistogram().GetSampleCount())
+}
+
+func TestMeteredStateVerifyContextFallbacks(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	// Blocks that should not be verified with a context aren't counted.
+	ctx := context.Background()
+	ctxBlk := state.WrapBlock(&chaintest.ContextBlock{Block: chaintest.NewBlock(genesis)})
+	require.NoError(ctxBlk.VerifyWithContext(ctx, &block.Context{}))
+	m := gatherMetric(t, registry, "chain_block_verify_context_fallbacks", "", "")
+	require.Zero(m.GetCounter().GetValue())
+
+	// Blocks that don't implement block.WithVerifyContext are counted.
+	blk := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk.VerifyWithContext(ctx, &block.Context{}))
+	m = gatherMetric(t, registry, "chain_block_verify_context_fallbacks", "", "")
+	require.Equal(1.0, m.GetCounter().GetValue())
+}
+
+func TestMeteredStateCacheBytes(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+
+	m := gatherMetric(t, registry, "chain_state_cache_max_bytes", cacheLabel, decidedLabel)
+	require.Equal(float64(testCacheSize), m.GetGauge().GetValue())
+
+	// Only the genesis block is decided.
+	genesisSize := cachedBlockSize(genesis.ID(), state.LastAcceptedBlock())
+	m = gatherMetric(t, registry, "chain_state_cache_bytes", cacheLabel, decidedLabel)
+	require.InDelta(float64(genesisSize), m.GetGauge().GetValue(), 0.001)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	m = gatherMetric(t, registry, "chain_state_cache_bytes", cacheLabel, unverifiedLabel)
+	require.InDelta(float64(cachedBlockSize(child.ID(), blk.(*BlockWrapper))), m.GetGauge().GetValue(), 0.001)
+
+	require.NoError(blk.Verify(ctx))
+	m = gatherMetric(t, registry, "chain_state_cache_bytes", cacheLabel, unverifiedLabel)
+	require.Zero(m.GetGauge().GetValue())
+}
+
+func TestMeteredStateLastAccepted(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	genesis.TimestampV = time.Unix(10, 0)
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	height := gatherMetric(t, registry, "chain_last_accepted_height", "", "").GetGauge()
+	require.Zero(height.GetValue())
+	timestamp := gatherMetric(t, registry, "chain_last_accepted_timestamp", "", "").GetGauge()
+	require.InDelta(10, timestamp.GetValue(), 0)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	child.TimestampV = time.Unix(20, 0)
+	blk := state.WrapBlock(child)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	height = gatherMetric(t, registry, "chain_last_accepted_height", "", "").GetGauge()
+	require.InDelta(1, height.GetValue(), 0)
+	timestamp = gatherMetric(t, registry, "chain_last_accepted_timestamp", "", "").GetGauge()
+	require.InDelta(20, timestamp.GetValue(), 0)
+}
+
+func TestMeteredStateLiveWrappers(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	liveWrappers := func() float64 {
+		return gatherMetric(t, registry, "chain_state_live_wrappers", "", "").GetGauge().GetValue()
+	}
+	require.Zero(liveWrappers())
+
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	abandoned := state.WrapBlock(chaintest.NewBlock(genesis))
+	for _, blk := range []*BlockWrapper{accepted, rejected, abandoned} {
+		require.NoError(blk.Verify(ctx))
+	}
+	require.InDelta(3, liveWrappers(), 0)
+
+	// Wrapping a cached block doesn't create a wrapper.
+	require.Same(accepted, state.WrapBlock(accepted.Block))
+	require.InDelta(3, liveWrappers(), 0)
+
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+	require.InDelta(1, liveWrappers(), 0)
+
+	// Repeated decisions aren't counted twice.
+	require.NoError(rejected.Reject(ctx))
+	require.InDelta(1, liveWrappers(), 0)
+}
+
+func TestMeteredStateReorgDepth(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	a1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	a2 := state.WrapBlock(chaintest.NewBlock(a1.Block.(*chaintest.Block)))
+	a3 := state.WrapBlock(chaintest.NewBlock(a2.Block.(*chaintest.Block)))
+	b2 := state.WrapBlock(chaintest.NewBlock(a1.Block.(*chaintest.Block)))
+	for _, blk := range []*BlockWrapper{a1, a2, a3, b2} {
+		require.NoError(blk.Verify(ctx))
+	}
+	for _, blk := range []*BlockWrapper{a1, a2, a3} {
+		require.NoError(blk.Accept(ctx))
+	}
+	histogram := gatherMetric(t, registry, "chain_reorg_depth", "", "").GetHistogram()
+	require.Zero(histogram.GetSampleCount())
+
+	// Accepting [b2] reorgs [a2] and [a3] out of the accepted chain.
+	require.NoError(b2.Accept(ctx))
+	histogram = gatherMetric(t, registry, "chain_reorg_depth", "", "").GetHistogram()
+	require.Equal(uint64(1), histogram.GetSampleCount())
+	require.InDelta(2, histogram.GetSampleSum(), 0)
+
+	// The depth is unknown if the ancestry isn't cached.
+	orphan := chaintest.NewBlock(b2.Block.(*chaintest.Block))
+	orphan.ParentV = ids.GenerateTestID()
+	orphanBlk := state.WrapBlock(orphan)
+	require.NoError(orphanBlk.Verify(ctx))
+	require.NoError(orphanBlk.Accept(ctx))
+	unknown := gatherMetric(t, registry, "chain_reorg_depth_unknown", "", "").GetCounter().GetValue()
+	require.InDelta(1, unknown, 0)
+}
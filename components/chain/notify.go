@@ -0,0 +1,73 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"sync"
+
+	"github.com/luxfi/ids"
+)
+
+// acceptedNotifier sends the IDs of accepted blocks to a buffered channel,
+// dropping the oldest IDs instead of blocking once the buffer is full.
+type acceptedNotifier struct {
+	// lock serializes the sends with closing the channel.
+	lock   sync.Mutex
+	ch     chan ids.ID
+	closed bool
+}
+
+func newAcceptedNotifier(size int) *acceptedNotifier {
+	return &acceptedNotifier{
+		ch: make(chan ids.ID, size),
+	}
+}
+
+// notify sends [blkID] to the channel, dropping the oldest ID if the channel
+// is full. It does nothing once the channel is closed.
+func (n *acceptedNotifier) notify(blkID ids.ID) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.closed {
+		return
+	}
+	for {
+		select {
+		case n.ch <- blkID:
+			return
+		default:
+		}
+		// The buffer is full, so the oldest ID is dropped. The receiver may
+		// have emptied the buffer in the meantime, in which case nothing is
+		// dropped.
+		select {
+		case <-n.ch:
+		default:
+		}
+	}
+}
+
+// close closes the channel, if it isn't already closed.
+func (n *acceptedNotifier) close() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if !n.closed {
+		n.closed = true
+		close(n.ch)
+	}
+}
+
+// AcceptedCh returns a channel that receives the ID of every block once it is
+// accepted, in the order the blocks are accepted. The channel is buffered by
+// [Config.AcceptedChSize] IDs. Accepting a block never waits for the receiver:
+// if the buffer is full, the oldest ID is dropped to make room for the new
+// one, so a slow receiver should compare the heights of the blocks it
+// receives to detect gaps.
+//
+// The channel is closed by [State.Close].
+func (s *State) AcceptedCh() <-chan ids.ID {
+	return s.acceptedNotifier.ch
+}
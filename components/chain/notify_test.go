@@ -0,0 +1,73 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestAcceptedCh(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.AcceptedChSize = 2
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := genesis
+	var accepted []ids.ID
+	for range 3 {
+		blk := state.WrapBlock(chaintest.NewBlock(parent))
+		require.NoError(blk.Verify(ctx))
+		require.NoError(blk.Accept(ctx))
+		accepted = append(accepted, blk.ID())
+		parent = blk.Block.(*chaintest.Block)
+	}
+
+	// The buffer only holds 2 IDs, so the oldest was dropped.
+	acceptedCh := state.AcceptedCh()
+	require.Equal(accepted[1], <-acceptedCh)
+	require.Equal(accepted[2], <-acceptedCh)
+
+	// Rejected blocks aren't notified.
+	rejected := state.WrapBlock(chaintest.NewBlock(parent))
+	require.NoError(rejected.Verify(ctx))
+	require.NoError(rejected.Reject(ctx))
+	require.Empty(acceptedCh)
+
+	require.NoError(state.Close())
+	_, ok := <-acceptedCh
+	require.False(ok)
+
+	// Closing again doesn't panic.
+	require.NoError(state.Close())
+}
+
+func TestAcceptedChKeyFunc(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.KeyFunc = func(blk block.Block) ids.ID {
+		return blk.ID().Prefix(1)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// The channel receives the ID of the block rather than its key.
+	ctx := context.Background()
+	blk := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Equal(blk.ID(), <-state.AcceptedCh())
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luxfi/ids"
+)
+
+// ParentStateProvider is implemented by blocks that expose the root of the
+// state resulting from their execution. If [Config.ProvideParentState] is set,
+// the root of the parent of a block is passed to its verification.
+type ParentStateProvider interface {
+	StateRoot() ids.ID
+}
+
+// ParentStateRootKey is the key of the context value holding the state root
+// of the parent of the block being verified, as an ids.ID. It is set if
+// [Config.ProvideParentState] is set and the parent implements
+// [ParentStateProvider].
+type ParentStateRootKey struct{}
+
+// ParentStateRoot returns the state root of the parent of the block being
+// verified with [ctx], if it was provided.
+func ParentStateRoot(ctx context.Context) (ids.ID, bool) {
+	root, ok := ctx.Value(ParentStateRootKey{}).(ids.ID)
+	return root, ok
+}
+
+// optionSiblings is shared by the options of an oracle block, so that the
+// state root of the oracle block is only loaded once for both options.
+type optionSiblings struct {
+	// parentID is the ID of the oracle block.
+	parentID ids.ID
+
+	lock    sync.Mutex
+	root    ids.ID
+	hasRoot bool
+}
+
+// withParentState returns [ctx] carrying the state root of the parent of
+// [bw], if [Config.ProvideParentState] is set and the parent is processing or
+// last accepted and implements ParentStateProvider. Otherwise, [ctx] is
+// returned as is.
+func (s *State) withParentState(ctx context.Context, bw *BlockWrapper) context.Context {
+	if !s.provideParentState {
+		return ctx
+	}
+
+	siblings := bw.siblings.Load()
+	if siblings == nil || siblings.parentID != bw.Parent() {
+		root, ok := s.parentStateRoot(bw)
+		if !ok {
+			return ctx
+		}
+		return context.WithValue(ctx, ParentStateRootKey{}, root)
+	}
+
+	// The lock is held while loading the root, so that concurrent
+	// verifications of both options load it once.
+	siblings.lock.Lock()
+	defer siblings.lock.Unlock()
+
+	if !siblings.hasRoot {
+		root, ok := s.parentStateRoot(bw)
+		if !ok {
+			return ctx
+		}
+		siblings.root = root
+		siblings.hasRoot = true
+	}
+	return context.WithValue(ctx, ParentStateRootKey{}, siblings.root)
+}
+
+// parentStateRoot returns the state root of the parent of [bw], if the parent
+// is processing or last accepted and implements ParentStateProvider.
+func (s *State) parentStateRoot(bw *BlockWrapper) (ids.ID, bool) {
+	parent, ok := s.GetVerified(bw.Parent())
+	if !ok {
+		return ids.Empty, false
+	}
+	provider, ok := parent.Block.(ParentStateProvider)
+	if !ok {
+		return ids.Empty, false
+	}
+	return provider.StateRoot(), true
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var _ ParentStateProvider = (*stateRootBlock)(nil)
+
+// stateRootBlock exposes its state root and records the parent state root it
+// was verified with.
+type stateRootBlock struct {
+	*chaintest.Block
+
+	root         ids.ID
+	parentRoot   ids.ID
+	providedRoot bool
+}
+
+func (b *stateRootBlock) StateRoot() ids.ID {
+	return b.root
+}
+
+func (b *stateRootBlock) Verify(ctx context.Context) error {
+	b.parentRoot, b.providedRoot = ParentStateRoot(ctx)
+	return b.Block.Verify(ctx)
+}
+
+func newStateRootBlock(parent *chaintest.Block) *stateRootBlock {
+	return &stateRootBlock{
+		Block: chaintest.NewBlock(parent),
+		root:  ids.GenerateTestID(),
+	}
+}
+
+func TestProvideParentState(t *testing.T) {
+	for _, provideParentState := range []bool{false, true} {
+		t.Run(fmt.Sprintf("provideParentState=%t", provideParentState), func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.ProvideParentState = provideParentState
+			state, err := NewState(config)
+			require.NoError(err)
+
+			ctx := context.Background()
+			// The genesis block doesn't provide a state root.
+			parent := newStateRootBlock(genesis)
+			require.NoError(state.WrapBlock(parent).Verify(ctx))
+			require.False(parent.providedRoot)
+
+			child := newStateRootBlock(parent.Block)
+			require.NoError(state.WrapBlock(child).Verify(ctx))
+			require.Equal(provideParentState, child.providedRoot)
+			if provideParentState {
+				require.Equal(parent.root, child.parentRoot)
+			}
+		})
+	}
+}
+
+var _ OracleBlock = (*stateRootOracleBlock)(nil)
+
+// stateRootOracleBlock is an oracle block that counts the loads of its state
+// root.
+type stateRootOracleBlock struct {
+	*chaintest.Block
+
+	root      ids.ID
+	rootLoads int
+	options   [2]block.Block
+}
+
+func (b *stateRootOracleBlock) StateRoot() ids.ID {
+	b.rootLoads++
+	return b.root
+}
+
+func (b *stateRootOracleBlock) Options(context.Context) ([2]block.Block, error) {
+	return b.options, nil
+}
+
+func TestShareOptionParentState(t *testing.T) {
+	for _, share := range []bool{false, true} {
+		t.Run(fmt.Sprintf("share=%t", share), func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.ProvideParentState = true
+			config.ShareOptionParentState = share
+			state, err := NewState(config)
+			require.NoError(err)
+
+			oracle := &stateRootOracleBlock{
+				Block: chaintest.NewBlock(genesis),
+				root:  ids.GenerateTestID(),
+			}
+			options := [2]*stateRootBlock{
+				newStateRootBlock(oracle.Block),
+				newStateRootBlock(oracle.Block),
+			}
+			oracle.options = [2]block.Block{options[0], options[1]}
+
+			ctx := context.Background()
+			oracleBlk := state.WrapBlock(oracle)
+			require.NoError(oracleBlk.Verify(ctx))
+			wrappedOptions, err := oracleBlk.Options(ctx)
+			require.NoError(err)
+			for i, option := range wrappedOptions {
+				require.NoError(option.Verify(ctx))
+				require.Equal(oracle.root, options[i].parentRoot)
+			}
+
+			// The state root of the oracle block is loaded once if it is
+			// shared between the options.
+			expectedLoads := 2
+			if share {
+				expectedLoads = 1
+			}
+			require.Equal(expectedLoads, oracle.rootLoads)
+		})
+	}
+}
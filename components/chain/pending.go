@@ -0,0 +1,124 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/utils/linked"
+)
+
+// pendingBlock is a block whose verification failed because its parent was
+// not yet available.
+type pendingBlock struct {
+	parentID ids.ID
+	// verify retries the verification of the block.
+	verify func(context.Context) error
+}
+
+// pendingBlocks holds the blocks waiting for their parent. Only the [maxSize]
+// most recently parked blocks are retained.
+type pendingBlocks struct {
+	lock    sync.Mutex
+	maxSize int
+	// blocks is ordered from least to most recently parked.
+	blocks *linked.Hashmap[ids.ID, pendingBlock]
+}
+
+func newPendingBlocks(maxSize int) *pendingBlocks {
+	return &pendingBlocks{
+		maxSize: maxSize,
+		blocks:  linked.NewHashmap[ids.ID, pendingBlock](),
+	}
+}
+
+// park records that [blkID] should be verified again with [verify] once
+// [parentID] is verified or accepted. Returns the number of parked blocks.
+func (p *pendingBlocks) park(blkID ids.ID, parentID ids.ID, verify func(context.Context) error) int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.blocks.Delete(blkID)
+	if p.blocks.Len() >= p.maxSize {
+		oldestBlkID, _, _ := p.blocks.Oldest()
+		p.blocks.Delete(oldestBlkID)
+	}
+	p.blocks.Put(blkID, pendingBlock{
+		parentID: parentID,
+		verify:   verify,
+	})
+	return p.blocks.Len()
+}
+
+// take removes and returns the blocks waiting for [parentID], along with the
+// number of blocks that remain parked.
+func (p *pendingBlocks) take(parentID ids.ID) ([]pendingBlock, int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		blkIDs   []ids.ID
+		children []pendingBlock
+	)
+	for iter := p.blocks.NewIterator(); iter.Next(); {
+		if pending := iter.Value(); pending.parentID == parentID {
+			blkIDs = append(blkIDs, iter.Key())
+			children = append(children, pending)
+		}
+	}
+	for _, blkID := range blkIDs {
+		p.blocks.Delete(blkID)
+	}
+	return children, p.blocks.Len()
+}
+
+func (p *pendingBlocks) clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.blocks.Clear()
+}
+
+// parkPending parks [bw], which failed verification with
+// [Config.MissingParentErr], until its parent is verified or accepted.
+func (s *State) parkPending(bw *BlockWrapper, verify func(context.Context) error) {
+	numPending := s.pending.park(bw.key(), bw.Parent(), verify)
+	s.metrics.setPending(numPending)
+}
+
+// retryPending verifies again the blocks that were parked waiting for
+// [parentID]. Blocks that pass verification are cached as unverified, and
+// their own parked children are verified again in turn. Failures are logged,
+// and blocks that are still missing their parent are parked again.
+func (s *State) retryPending(ctx context.Context, parentID ids.ID) {
+	if s.pending == nil {
+		return
+	}
+
+	children, numPending := s.pending.take(parentID)
+	s.metrics.setPending(numPending)
+	for _, child := range children {
+		if err := child.verify(ctx); err != nil {
+			s.log.Debug("failed to verify pending block",
+				"parentID", parentID,
+				"error", err,
+			)
+		}
+	}
+}
+
+// NumPending returns the number of blocks waiting for their parent to be
+// verified or accepted. See [Config.MissingParentErr].
+func (s *State) NumPending() int {
+	if s.pending == nil {
+		return 0
+	}
+
+	s.pending.lock.Lock()
+	defer s.pending.lock.Unlock()
+
+	return s.pending.blocks.Len()
+}
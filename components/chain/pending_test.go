@@ -0,0 +1,152 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/metric"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var errTestMissingParent = errors.New("test missing parent")
+
+func TestPendingBlocks(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	registry := metric.NewRegistry()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.MissingParentErr = errTestMissingParent
+	config.MaxPendingBlocks = 2
+	state, err := NewMeteredState(registry, config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := chaintest.NewBlock(genesis)
+	child := chaintest.NewBlock(parent)
+	grandchild := chaintest.NewBlock(child)
+	child.VerifyV = errTestMissingParent
+	grandchild.VerifyV = errTestMissingParent
+	childBlk := state.WrapBlock(child)
+	grandchildBlk := state.WrapBlock(grandchild)
+
+	// Blocks missing their parent are parked.
+	require.ErrorIs(grandchildBlk.Verify(ctx), errTestMissingParent)
+	require.ErrorIs(childBlk.Verify(ctx), errTestMissingParent)
+	require.Equal(2, state.NumPending())
+	pending := gatherMetric(t, registry, "chain_state_pending_blocks", "", "").GetGauge().GetValue()
+	require.InDelta(2, pending, 0)
+
+	// Verifying the parent verifies the parked children, which in turn
+	// verifies their parked children. As consensus saw their verification
+	// fail, they are cached as unverified rather than processing.
+	child.VerifyV = nil
+	grandchild.VerifyV = nil
+	parentBlk := state.WrapBlock(parent)
+	require.NoError(parentBlk.Verify(ctx))
+	for _, blk := range []*BlockWrapper{childBlk, grandchildBlk} {
+		status, ok := state.Status(blk.ID())
+		require.True(ok)
+		require.Equal(StatusUnverified, status)
+		require.Equal(CacheLocationUnverified, blk.CacheLocation())
+	}
+	require.Equal([]ids.ID{parent.ID()}, state.ProcessingIDs())
+	require.Zero(state.NumPending())
+	pending = gatherMetric(t, registry, "chain_state_pending_blocks", "", "").GetGauge().GetValue()
+	require.Zero(pending)
+
+	// Consensus can verify them again.
+	require.NoError(childBlk.Verify(ctx))
+	require.NoError(grandchildBlk.Verify(ctx))
+	require.True(state.IsProcessing(child.ID()))
+	require.True(state.IsProcessing(grandchild.ID()))
+}
+
+func TestPendingBlocksNotProcessing(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.MissingParentErr = errTestMissingParent
+	config.MaxPendingBlocks = 2
+	config.MaxProcessing = 1
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := chaintest.NewBlock(genesis)
+	child := chaintest.NewBlock(parent)
+	grandchild := chaintest.NewBlock(child)
+	child.VerifyV = errTestMissingParent
+	grandchild.VerifyV = errTestMissingParent
+	childBlk := state.WrapBlock(child)
+	grandchildBlk := state.WrapBlock(grandchild)
+	require.ErrorIs(grandchildBlk.Verify(ctx), errTestMissingParent)
+	require.ErrorIs(childBlk.Verify(ctx), errTestMissingParent)
+
+	// The retried blocks don't count towards [Config.MaxProcessing], so they
+	// are verified again even though the limit is reached.
+	child.VerifyV = nil
+	grandchild.VerifyV = nil
+	parentBlk := state.WrapBlock(parent)
+	require.NoError(parentBlk.Verify(ctx))
+	require.Zero(state.NumPending())
+	require.Equal(CacheLocationUnverified, childBlk.CacheLocation())
+	require.Equal(CacheLocationUnverified, grandchildBlk.CacheLocation())
+	require.Equal([]ids.ID{parent.ID()}, state.ProcessingIDs())
+	require.ErrorIs(childBlk.Verify(ctx), errTooManyProcessing)
+
+	require.NoError(parentBlk.Accept(ctx))
+	require.NoError(childBlk.Verify(ctx))
+	require.Equal([]ids.ID{child.ID()}, state.ProcessingIDs())
+}
+
+func TestPendingBlocksRetriedOnAccept(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.MissingParentErr = errTestMissingParent
+	config.MaxPendingBlocks = 1
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := chaintest.NewBlock(genesis)
+	child := chaintest.NewBlock(parent)
+	child.VerifyV = errTestMissingParent
+	childBlk := state.WrapBlock(child)
+	require.ErrorIs(childBlk.Verify(ctx), errTestMissingParent)
+
+	// The child still requires its parent to be accepted, so it is parked
+	// again.
+	parentBlk := state.WrapBlock(parent)
+	require.NoError(parentBlk.Verify(ctx))
+	require.False(state.IsProcessing(child.ID()))
+	require.Equal(1, state.NumPending())
+
+	child.VerifyV = nil
+	require.NoError(parentBlk.Accept(ctx))
+	require.False(state.IsProcessing(child.ID()))
+	require.Equal(CacheLocationUnverified, childBlk.CacheLocation())
+	require.Zero(state.NumPending())
+	require.NoError(childBlk.Verify(ctx))
+	require.True(state.IsProcessing(child.ID()))
+
+	// The oldest parked blocks are dropped once the limit is reached.
+	for range 2 {
+		blk := chaintest.NewBlock(child)
+		blk.VerifyV = errTestMissingParent
+		require.ErrorIs(state.WrapBlock(blk).Verify(ctx), errTestMissingParent)
+	}
+	require.Equal(1, state.NumPending())
+	require.NoError(state.Close())
+	require.Zero(state.NumPending())
+}
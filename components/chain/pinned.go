@@ -0,0 +1,156 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"sync"
+
+	"github.com/luxfi/cache"
+	"github.com/luxfi/ids"
+)
+
+var _ cache.Cacher[ids.ID, decidedBlock] = (*pinnedDecidedCache)(nil)
+
+// pinnedDecidedCache wraps the cache of decided blocks so that the decided
+// parents of verified blocks remain resident until all of their verified
+// children are decided. Pinned blocks are still evicted from the wrapped
+// cache, but are returned by Get until they are unpinned.
+type pinnedDecidedCache struct {
+	cache.Cacher[ids.ID, decidedBlock]
+
+	lock sync.Mutex
+	pins map[ids.ID]*pinnedBlock
+}
+
+// pinnedBlock is a decided block along with the number of verified blocks
+// that reference it as their parent.
+type pinnedBlock struct {
+	blk  decidedBlock
+	refs int
+}
+
+func newPinnedDecidedCache(c cache.Cacher[ids.ID, decidedBlock]) *pinnedDecidedCache {
+	return &pinnedDecidedCache{
+		Cacher: c,
+		pins:   make(map[ids.ID]*pinnedBlock),
+	}
+}
+
+func (c *pinnedDecidedCache) Get(blkID ids.ID) (decidedBlock, bool) {
+	if blk, ok := c.Cacher.Get(blkID); ok {
+		return blk, true
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pin, ok := c.pins[blkID]
+	if !ok {
+		return decidedBlock{}, false
+	}
+	return pin.blk, true
+}
+
+// pin adds a reference to [blk], the decided block [blkID].
+func (c *pinnedDecidedCache) pin(blkID ids.ID, blk decidedBlock) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pin, ok := c.pins[blkID]
+	if !ok {
+		pin = &pinnedBlock{blk: blk}
+		c.pins[blkID] = pin
+	}
+	pin.refs++
+}
+
+// unpin removes a reference to [blkID], if it is pinned.
+func (c *pinnedDecidedCache) unpin(blkID ids.ID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	pin, ok := c.pins[blkID]
+	if !ok {
+		return
+	}
+	pin.refs--
+	if pin.refs == 0 {
+		delete(c.pins, blkID)
+	}
+}
+
+// drop removes [blkID] from the pinned blocks, regardless of its references.
+func (c *pinnedDecidedCache) drop(blkID ids.ID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pins, blkID)
+}
+
+// eachPinned calls [f] with every pinned block. [f] must not call into the
+// cache.
+func (c *pinnedDecidedCache) eachPinned(f func(ids.ID, decidedBlock)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for blkID, pin := range c.pins {
+		f(blkID, pin.blk)
+	}
+}
+
+// isPinned returns true if [blkID] is pinned.
+func (c *pinnedDecidedCache) isPinned(blkID ids.ID) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	_, ok := c.pins[blkID]
+	return ok
+}
+
+// numPinned returns the number of pinned blocks.
+func (c *pinnedDecidedCache) numPinned() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.pins)
+}
+
+// unpinAll removes all the pinned blocks.
+func (c *pinnedDecidedCache) unpinAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	clear(c.pins)
+}
+
+// decidedParent returns the parent of [bw] if it is decided, so that it can
+// be pinned once [bw] is verified.
+func (s *State) decidedParent(bw *BlockWrapper) (decidedBlock, bool) {
+	if bw.Height() == 0 {
+		return decidedBlock{}, false
+	}
+	return s.decidedBlocks.Get(bw.Parent())
+}
+
+// pinParent pins [parent], the decided parent of [bw], which was just added
+// to the verified blocks.
+//
+// Assumes [s.lock] is held.
+func (s *State) pinParent(bw *BlockWrapper, parent decidedBlock, decided bool) {
+	if decided {
+		bw.pinnedParent = true
+		s.decidedBlocks.pin(bw.Parent(), parent)
+	}
+}
+
+// unpinParent releases the pin held by [bw] on its parent, once [bw] was
+// removed from the verified blocks.
+//
+// Assumes [s.lock] is held.
+func (s *State) unpinParent(bw *BlockWrapper) {
+	if bw.pinnedParent {
+		bw.pinnedParent = false
+		s.decidedBlocks.unpin(bw.Parent())
+	}
+}
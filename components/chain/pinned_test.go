@@ -0,0 +1,68 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/database"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestDecidedParentsPinned(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	parentBlk := chaintest.NewBlock(genesis)
+	parent := state.WrapBlock(parentBlk)
+	require.NoError(parent.Verify(ctx))
+	require.NoError(parent.Accept(ctx))
+
+	accepted := state.WrapBlock(chaintest.NewBlock(parentBlk))
+	rejected := state.WrapBlock(chaintest.NewBlock(parentBlk))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	require.Equal(1, state.decidedBlocks.numPinned())
+
+	// [parent] remains resident while [rejected] is processing, even once
+	// it is evicted from the decided blocks, so only the genesis block is
+	// counted as pruned.
+	require.NoError(accepted.Accept(ctx))
+	require.Equal(1, state.PruneDecidedBelow(accepted.Height()))
+	blk, err := state.GetBlock(ctx, parentBlk.ID())
+	require.NoError(err)
+	require.Same(parent, blk)
+	status, ok := state.Status(parentBlk.ID())
+	require.True(ok)
+	require.Equal(StatusAccepted, status)
+
+	// Once its children are decided, [parent] is unpinned.
+	require.NoError(rejected.Reject(ctx))
+	require.Zero(state.decidedBlocks.numPinned())
+	_, err = state.GetBlock(ctx, parentBlk.ID())
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestDecidedParentsUnpinnedOnClose(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(child.Verify(ctx))
+	require.Equal(1, state.decidedBlocks.numPinned())
+
+	require.NoError(state.Close())
+	require.Zero(state.decidedBlocks.numPinned())
+}
@@ -0,0 +1,61 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"fmt"
+
+	"github.com/luxfi/ids"
+)
+
+// UnknownPreferenceError is returned by [State.SetPreference] when the
+// preferred block is neither processing nor the last accepted block.
+type UnknownPreferenceError struct {
+	BlkID ids.ID
+}
+
+func (e *UnknownPreferenceError) Error() string {
+	return fmt.Sprintf("cannot prefer unknown block %s", e.BlkID)
+}
+
+// SetPreference records [blkID] as the block preferred by consensus, such
+// that new blocks can be built on top of it. [blkID] must be processing or be
+// the last accepted block.
+func (s *State) SetPreference(blkID ids.ID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if _, ok := s.verifiedBlocks.Get(blkID); !ok && !s.isLastAccepted(blkID) {
+		return &UnknownPreferenceError{BlkID: blkID}
+	}
+	s.preference = blkID
+	return nil
+}
+
+// Preference returns the block most recently preferred by consensus. If no
+// block was preferred, or the preferred block is no longer processing, the
+// last accepted block is returned instead.
+func (s *State) Preference() ids.ID {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if _, ok := s.verifiedBlocks.Get(s.preference); ok {
+		return s.preference
+	}
+	if s.lastAcceptedBlock == nil {
+		return ids.Empty
+	}
+	return s.lastAcceptedBlock.ID()
+}
+
+// isLastAccepted returns true if [blkID] is the key of the last accepted
+// block, as derived by [Config.KeyFunc].
+//
+// Assumes [s.lock] is held.
+func (s *State) isLastAccepted(blkID ids.ID) bool {
+	return s.lastAcceptedBlock != nil && s.lastAcceptedBlock.key() == blkID
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestSetPreference(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blk := chaintest.NewBlock(genesis)
+	sibling := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		blk.ID():     blk,
+		sibling.ID(): sibling,
+	}))
+	require.NoError(err)
+
+	// Without a preference, the last accepted block is preferred.
+	require.Equal(genesis.ID(), state.Preference())
+
+	// A block that isn't processing can't be preferred.
+	var unknownErr *UnknownPreferenceError
+	err = state.SetPreference(blk.ID())
+	require.ErrorAs(err, &unknownErr)
+	require.Equal(blk.ID(), unknownErr.BlkID)
+	require.ErrorAs(state.SetPreference(ids.GenerateTestID()), &unknownErr)
+	require.Equal(genesis.ID(), state.Preference())
+
+	bw, err := state.VerifyAndGet(ctx, blk)
+	require.NoError(err)
+	siblingBw, err := state.VerifyAndGet(ctx, sibling)
+	require.NoError(err)
+
+	require.NoError(state.SetPreference(blk.ID()))
+	require.Equal(blk.ID(), state.Preference())
+	require.NoError(state.SetPreference(sibling.ID()))
+	require.Equal(sibling.ID(), state.Preference())
+	require.NoError(state.SetPreference(genesis.ID()))
+	require.Equal(genesis.ID(), state.Preference())
+
+	// Once the preferred block is rejected, the last accepted block is
+	// preferred again.
+	require.NoError(state.SetPreference(sibling.ID()))
+	require.NoError(bw.Accept(ctx))
+	require.NoError(siblingBw.Reject(ctx))
+	require.Equal(blk.ID(), state.Preference())
+
+	require.NoError(state.Close())
+	require.ErrorIs(state.SetPreference(blk.ID()), ErrClosed)
+}
+
+func TestSetPreferenceKeyFunc(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.KeyFunc = func(blk block.Block) ids.ID {
+		return blk.ID().Prefix(1)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// The last accepted block is matched by its key, like in the caches.
+	genesisKey := genesis.ID().Prefix(1)
+	require.NoError(state.SetPreference(genesisKey))
+	bw, ok := state.GetVerified(genesisKey)
+	require.True(ok)
+	require.Same(state.LastAcceptedBlock(), bw)
+
+	var unknownErr *UnknownPreferenceError
+	require.ErrorAs(state.SetPreference(genesis.ID()), &unknownErr)
+	_, ok = state.GetVerified(genesis.ID())
+	require.False(ok)
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+)
+
+var errPrimeAboveLastAccepted = errors.New("primed block is above the last accepted block")
+
+// Prime warms the cache of decided blocks with [blks], which must all have
+// been accepted, such as the most recently accepted blocks loaded from an
+// index at startup. The blocks are cached as accepted without being accepted
+// again, and their heights are indexed for [State.GetBlockIDAtHeight].
+//
+// If the State has no last accepted block, the highest of [blks] becomes the
+// last accepted block, as if passed to [State.Initialize]. Otherwise, the last
+// accepted block is unchanged and no block may be above it. Blocks that are
+// already cached as decided or verified are left untouched.
+func (s *State) Prime(ctx context.Context, blks []block.Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if len(blks) == 0 {
+		return nil
+	}
+
+	// Prime the blocks from lowest to highest, so that the most recently
+	// accepted blocks are the last to be evicted.
+	blks = slices.Clone(blks)
+	slices.SortStableFunc(blks, func(a, b block.Block) int {
+		return cmp.Compare(a.Height(), b.Height())
+	})
+	highest := blks[len(blks)-1]
+
+	lastAcceptedBlock := s.LastAcceptedBlock()
+	if lastAcceptedBlock == nil {
+		if err := s.Initialize(ctx, highest); err != nil {
+			return err
+		}
+		blks = blks[:len(blks)-1]
+	} else if highest.Height() > lastAcceptedBlock.Height() {
+		return fmt.Errorf("%w: block %s at height %d is above %d",
+			errPrimeAboveLastAccepted,
+			highest.ID(),
+			highest.Height(),
+			lastAcceptedBlock.Height(),
+		)
+	}
+
+	s.lock.RLock()
+	closed := s.closed
+	s.lock.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	for _, blk := range blks {
+		blkID := s.key(blk)
+		if _, ok := s.verifiedBlocks.Get(blkID); ok {
+			continue
+		}
+		if _, ok := s.decidedBlocks.Get(blkID); ok {
+			continue
+		}
+
+		s.unverifiedBlocks.Evict(blkID)
+		s.missingBlocks.Evict(blkID)
+		// The decided blocks may call [Config.OnEvict], so [s.lock] must not
+		// be held.
+		s.decidedBlocks.Put(blkID, decidedBlock{
+			BlockWrapper: s.newBlockWrapper(blk),
+			accepted:     true,
+		})
+		s.acceptedHeights.Put(blk.Height(), blkID)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+// newAcceptedChain returns [length] accepted blocks built on top of [parent].
+func newAcceptedChain(parent *chaintest.Block, length int) []block.Block {
+	blks := make([]block.Block, length)
+	for i := range blks {
+		blk := chaintest.NewBlock(parent)
+		blk.StatusV = parent.StatusV
+		blks[i] = blk
+		parent = blk
+	}
+	return blks
+}
+
+func TestPrime(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blks := newAcceptedChain(genesis, 3)
+	lastAccepted := blks[2].(*chaintest.Block)
+	// The VM doesn't know the primed blocks, so they can only be served from
+	// the cache.
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.LastAcceptedBlock = lastAccepted
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// Blocks above the last accepted block can't be primed.
+	above := chaintest.NewBlock(lastAccepted)
+	err = state.Prime(ctx, []block.Block{blks[0], above})
+	require.ErrorIs(err, errPrimeAboveLastAccepted)
+	status, _ := state.Status(blks[0].ID())
+	require.Equal(StatusUnknown, status)
+
+	require.NoError(state.Prime(ctx, []block.Block{blks[1], blks[0]}))
+	require.Equal(lastAccepted.ID(), state.LastAcceptedID())
+	for _, blk := range blks {
+		status, _ := state.Status(blk.ID())
+		require.Equal(StatusAccepted, status)
+
+		got, err := state.GetBlock(ctx, blk.ID())
+		require.NoError(err)
+		require.Equal(blk.ID(), got.ID())
+
+		blkID, err := state.GetBlockIDAtHeight(ctx, blk.Height())
+		require.NoError(err)
+		require.Equal(blk.ID(), blkID)
+	}
+
+	// Children of primed blocks can be verified and accepted.
+	child := state.WrapBlock(chaintest.NewBlock(lastAccepted))
+	require.NoError(child.Verify(ctx))
+	require.NoError(child.Accept(ctx))
+}
+
+func TestPrimeUninitialized(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blks := newAcceptedChain(genesis, 2)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.LastAcceptedBlock = nil
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// The highest primed block becomes the last accepted block.
+	require.NoError(state.Prime(ctx, []block.Block{blks[1], blks[0]}))
+	require.Equal(blks[1].ID(), state.LastAcceptedID())
+	status, _ := state.Status(blks[0].ID())
+	require.Equal(StatusAccepted, status)
+
+	require.NoError(state.Close())
+	require.ErrorIs(state.Prime(ctx, blks), ErrClosed)
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import "github.com/luxfi/ids"
+
+// observeReorg reports the depth of the reorg caused by accepting [newTip]
+// when [prevTip] was the last accepted block. The depth is the number of
+// blocks accepted after the common ancestor of [prevTip] and [newTip] that
+// are no longer on the accepted chain.
+func (s *State) observeReorg(prevTip, newTip *BlockWrapper) {
+	if s.metrics == nil {
+		return
+	}
+
+	depth, ok := s.reorgDepth(prevTip, newTip)
+	if ok && depth == 0 {
+		// [newTip] descends from [prevTip], so nothing was reorged.
+		return
+	}
+	s.metrics.reorg(depth, ok)
+}
+
+// reorgDepth walks the cached ancestry of [prevTip] and [newTip] back to their
+// common ancestor. Returns false if an ancestor is not cached.
+func (s *State) reorgDepth(prevTip, newTip *BlockWrapper) (uint64, bool) {
+	var (
+		prev = prevTip
+		next = newTip
+		ok   bool
+	)
+	for next.Height() > prev.Height() {
+		if next, ok = s.cachedParent(next); !ok {
+			return 0, false
+		}
+	}
+	for prev.Height() > next.Height() {
+		if prev, ok = s.cachedParent(prev); !ok {
+			return 0, false
+		}
+	}
+	for prev.key() != next.key() {
+		if prev, ok = s.cachedParent(prev); !ok {
+			return 0, false
+		}
+		if next, ok = s.cachedParent(next); !ok {
+			return 0, false
+		}
+	}
+	return prevTip.Height() - prev.Height(), true
+}
+
+// cachedParent returns the parent of [bw] if it is processing or decided,
+// without recording any cache lookups.
+func (s *State) cachedParent(bw *BlockWrapper) (*BlockWrapper, bool) {
+	if bw.Height() == 0 {
+		return nil, false
+	}
+	return s.cachedAncestor(bw.Parent())
+}
+
+func (s *State) cachedAncestor(blkID ids.ID) (*BlockWrapper, bool) {
+	blk, ok := s.verifiedBlocks.Get(blkID)
+	if ok {
+		return blk, true
+	}
+
+	decidedBlk, ok := s.decidedBlocks.Get(blkID)
+	return decidedBlk.BlockWrapper, ok
+}
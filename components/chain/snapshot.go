@@ -0,0 +1,107 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+)
+
+var errInvalidSnapshot = errors.New("invalid snapshot")
+
+// BlockLoader loads the block [blkID] from the VM's storage.
+type BlockLoader func(ctx context.Context, blkID ids.ID) (block.Block, error)
+
+// Snapshot returns an encoding of the IDs of the last accepted block and of
+// its ancestors that are cached as decided, ordered from the last accepted
+// block backwards. The snapshot can be passed to [State.Restore] after a
+// restart to warm the decided block cache.
+//
+// Only the contiguous accepted ancestry of the last accepted block is
+// included: the walk stops at the first ancestor that isn't cached, and
+// decided blocks outside of that chain, such as rejected blocks, are not
+// included. Block bytes are not included.
+func (s *State) Snapshot() ([]byte, error) {
+	blk := s.LastAcceptedBlock()
+	if blk == nil {
+		return nil, nil
+	}
+
+	snapshot := make([]byte, 0, ids.IDLen)
+	for {
+		blkID := blk.key()
+		snapshot = append(snapshot, blkID[:]...)
+
+		parent, ok := s.decidedBlocks.Get(blk.Parent())
+		if !ok || !parent.accepted || parent.Height()+1 != blk.Height() {
+			return snapshot, nil
+		}
+		blk = parent.BlockWrapper
+	}
+}
+
+// Restore loads the blocks in [snapshot], as produced by [State.Snapshot],
+// with [loader] and caches them. Blocks are cached as if they were returned
+// by [Config.GetBlock], so blocks above the current last accepted height are
+// cached as unverified rather than decided. If State has no last accepted
+// block, it is initialized with the last accepted block of the snapshot, as
+// by [State.Initialize].
+//
+// Blocks that are already cached are not loaded again.
+func (s *State) Restore(ctx context.Context, snapshot []byte, loader BlockLoader) error {
+	if len(snapshot)%ids.IDLen != 0 {
+		return fmt.Errorf("%w: length %d is not a multiple of %d", errInvalidSnapshot, len(snapshot), ids.IDLen)
+	}
+
+	if len(snapshot) != 0 && s.LastAcceptedBlock() == nil {
+		lastAcceptedID, err := ids.ToID(snapshot[:ids.IDLen])
+		if err != nil {
+			return err
+		}
+		lastAccepted, err := s.loadSnapshotBlock(ctx, lastAcceptedID, loader)
+		if err != nil {
+			return err
+		}
+		if err := s.Initialize(ctx, lastAccepted); err != nil {
+			return err
+		}
+	}
+
+	// Restore the oldest blocks first so that the most recently accepted
+	// blocks are the last to be evicted.
+	for i := len(snapshot) - ids.IDLen; i >= 0; i -= ids.IDLen {
+		blkID, err := ids.ToID(snapshot[i : i+ids.IDLen])
+		if err != nil {
+			return err
+		}
+		if _, ok := s.getCachedBlock(blkID); ok {
+			continue
+		}
+
+		blk, err := s.loadSnapshotBlock(ctx, blkID, loader)
+		if err != nil {
+			return err
+		}
+		s.missingBlocks.Evict(blkID)
+		s.addBlockOutsideConsensus(blk)
+	}
+	return nil
+}
+
+// loadSnapshotBlock loads [blkID] with [loader], checking that the loaded
+// block has the expected ID.
+func (s *State) loadSnapshotBlock(ctx context.Context, blkID ids.ID, loader BlockLoader) (block.Block, error) {
+	blk, err := loader(ctx, blkID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", blkID, err)
+	}
+	if loadedID := s.key(blk); loadedID != blkID {
+		return nil, fmt.Errorf("%w: loaded %s instead of %s", errInvalidSnapshot, loadedID, blkID)
+	}
+	return blk, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blk2 := chaintest.NewBlock(blk1)
+	blks := chaintest.Blocks{}
+	state, err := NewState(newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	ctx := context.Background()
+	for _, blk := range []*chaintest.Block{blk1, blk2} {
+		bw := state.WrapBlock(blk)
+		require.NoError(bw.Verify(ctx))
+		require.NoError(bw.Accept(ctx))
+	}
+
+	snapshot, err := state.Snapshot()
+	require.NoError(err)
+	require.Len(snapshot, 3*ids.IDLen)
+
+	// Restart from the last accepted block with cold caches.
+	blks[blk1.ID()] = blk1
+	blks[blk2.ID()] = blk2
+	config := newTestConfig(blk2, blks)
+	restored, err := NewState(config)
+	require.NoError(err)
+	_, ok := restored.Status(blk1.ID())
+	require.False(ok)
+
+	var loaded []ids.ID
+	loader := func(ctx context.Context, blkID ids.ID) (block.Block, error) {
+		loaded = append(loaded, blkID)
+		return blks.GetBlock(ctx, blkID)
+	}
+	require.NoError(restored.Restore(ctx, snapshot, loader))
+	require.Equal([]ids.ID{genesis.ID(), blk1.ID()}, loaded)
+	for _, blkID := range []ids.ID{genesis.ID(), blk1.ID(), blk2.ID()} {
+		status, ok := restored.Status(blkID)
+		require.True(ok)
+		require.Equal(StatusAccepted, status)
+	}
+
+	err = restored.Restore(ctx, snapshot[1:], loader)
+	require.ErrorIs(err, errInvalidSnapshot)
+}
+
+func TestRestoreWithoutLastAccepted(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{blk1.ID(): blk1}
+	state, err := NewState(newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	ctx := context.Background()
+	bw := state.WrapBlock(blk1)
+	require.NoError(bw.Verify(ctx))
+	require.NoError(bw.Accept(ctx))
+	snapshot, err := state.Snapshot()
+	require.NoError(err)
+
+	// Restore into a State that wasn't given a last accepted block.
+	config := newTestConfig(genesis, blks)
+	config.LastAcceptedBlock = nil
+	restored, err := NewState(config)
+	require.NoError(err)
+	require.Nil(restored.LastAcceptedBlock())
+
+	require.NoError(restored.Restore(ctx, snapshot, blks.GetBlock))
+	require.Equal(blk1.ID(), restored.LastAcceptedID())
+	for _, blkID := range []ids.ID{genesis.ID(), blk1.ID()} {
+		status, ok := restored.Status(blkID)
+		require.True(ok)
+		require.Equal(StatusAccepted, status)
+	}
+}
@@ -4,25 +4,66 @@
 package chain
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
 
 	"github.com/luxfi/cache"
 	"github.com/luxfi/cache/lru"
 	"github.com/luxfi/cache/metercacher"
+	"github.com/luxfi/consensus/core/choices"
 	"github.com/luxfi/consensus/engine/chain/block"
 	"github.com/luxfi/constants"
 	"github.com/luxfi/database"
 	"github.com/luxfi/ids"
+	"github.com/luxfi/log"
 	"github.com/luxfi/metric"
 )
 
+const (
+	// optionsCacheSize is the number of oracle blocks whose options are
+	// cached.
+	optionsCacheSize = 256
+	// shouldVerifyWithContextCacheSize is the number of blocks whose
+	// ShouldVerifyWithContext results are cached.
+	shouldVerifyWithContextCacheSize = 2048
+)
 
 func cachedBlockSize(_ ids.ID, bw *BlockWrapper) int {
 	return ids.IDLen + len(bw.Bytes()) + 2*constants.PointerOverhead
 }
 
+func cachedDecidedBlockSize(blkID ids.ID, blk decidedBlock) int {
+	return cachedBlockSize(blkID, blk.BlockWrapper)
+}
+
+// onEvictDecided adapts [onEvict] to the decided blocks cache.
+func onEvictDecided(onEvict func(ids.ID, block.Block)) func(ids.ID, decidedBlock) {
+	if onEvict == nil {
+		return nil
+	}
+	return func(blkID ids.ID, blk decidedBlock) {
+		onEvict(blkID, blk.Block)
+	}
+}
+
+// onEvictUnverified adapts [onEvict] to the unverified blocks cache.
+func onEvictUnverified(onEvict func(ids.ID, block.Block)) func(ids.ID, *BlockWrapper) {
+	if onEvict == nil {
+		return nil
+	}
+	return func(blkID ids.ID, bw *BlockWrapper) {
+		onEvict(blkID, bw.Block)
+	}
+}
+
 func cachedBlockBytesSize(blockBytes string, _ ids.ID) int {
 	return len(blockBytes) + ids.IDLen
 }
@@ -45,69 +86,276 @@ type State struct {
 	// If nil, [BuildBlockWithContext] returns [BuildBlock].
 	buildBlockWithContext func(context.Context, *block.Context) (block.Block, error)
 
-	// verifiedBlocks is a map of blocks that have been verified and are
-	// therefore currently in consensus.
-	verifiedBlocks map[ids.ID]*BlockWrapper
+	// lock protects [lastAcceptedBlock], [preference] and [closed], and serializes the
+	// updates of [verifiedBlocks] with them. It is only held while these
+	// fields are read or mutated, never while calling into the underlying
+	// block. [verifiedBlocks] is safe for concurrent use, so looking up a
+	// single verified block does not require it.
+	lock sync.RWMutex
+	// closed is set by [Close], after which blocks can no longer be verified
+	// or decided.
+	closed bool
+	// maxProcessing is set by [Config.MaxProcessing].
+	maxProcessing int
+	// decidedCacheSize is set by [Config.DecidedCacheSize], or zero if
+	// [Config.DisableDecidedCache] is set.
+	decidedCacheSize int
+	// unverifiedCacheSize is set by [Config.UnverifiedCacheSize].
+	unverifiedCacheSize int
+	// verifySlots bounds the concurrent verifications of underlying blocks.
+	// It is nil unless [Config.MaxConcurrentVerify] is set.
+	verifySlots *semaphore.Weighted
+	// cascadeReject is set by [Config.CascadeReject].
+	cascadeReject bool
+	// autoOrphanCleanup is set by [Config.AutoOrphanCleanup].
+	autoOrphanCleanup bool
+	// checkHeightContinuity is set by [Config.CheckHeightContinuity].
+	checkHeightContinuity bool
+	// strictParents is set by [Config.StrictParents].
+	strictParents bool
+	// disableDecidedCache is set by [Config.DisableDecidedCache].
+	disableDecidedCache bool
+	// disableRejectedCache is set by [Config.DisableRejectedCache].
+	disableRejectedCache bool
+	// shareOptionParentState is set by [Config.ShareOptionParentState].
+	shareOptionParentState bool
+	// readOnly is set by [Config.ReadOnly].
+	readOnly bool
+	// readOnlyVerified holds the blocks verified in read-only mode, which are
+	// children of the last accepted block waiting to be reported accepted by
+	// [State.ReportAccepted]. It is protected by [lock].
+	readOnlyVerified map[ids.ID]*BlockWrapper
+	// trustedRehydrate is set by [Config.TrustedRehydrate].
+	trustedRehydrate bool
+	// strictVerifyContext is set by [Config.StrictVerifyContext].
+	strictVerifyContext bool
+	// validateContext is set by [Config.ValidateContext].
+	validateContext func(*block.Context) error
+	// keyFunc is set by [Config.KeyFunc].
+	keyFunc func(block.Block) ids.ID
+	// acceptedNotifier backs [State.AcceptedCh].
+	acceptedNotifier *acceptedNotifier
+	// onAccept is set by [Config.OnAccept].
+	onAccept func(context.Context, *BlockWrapper) error
+	// decisionTimeout is set by [Config.DecisionTimeout].
+	decisionTimeout time.Duration
+	// provideParentState is set by [Config.ProvideParentState].
+	provideParentState bool
+	// preVerify is set by [Config.PreVerify].
+	preVerify func(context.Context, block.Block) error
+	// verifiedBlocks holds the blocks that have been verified and are
+	// therefore currently in consensus. Its implementation is selected by
+	// [Config.VerifiedMap].
+	verifiedBlocks verifiedBlocks
 	// decidedBlocks is an LRU cache of decided blocks.
-	decidedBlocks cache.Cacher[ids.ID, *BlockWrapper]
+	// Decided blocks that are the parent of a verified block are pinned, so
+	// that they remain resident until their children are decided.
+	decidedBlocks *pinnedDecidedCache
+	// decidedEntries is the cache underlying [decidedBlocks], which may be
+	// wrapped by metering. It is only used to enumerate the decided blocks.
+	decidedEntries enumerableCache[ids.ID, decidedBlock]
 	// unverifiedBlocks is an LRU cache of blocks with status processing
 	// that have not yet passed verification.
 	unverifiedBlocks cache.Cacher[ids.ID, *BlockWrapper]
+	// unverifiedLRU is the cache underlying [unverifiedBlocks], which may be
+	// wrapped by metering. It is swept for expired blocks if
+	// [Config.UnverifiedTTL] is set.
+	unverifiedLRU *lruCache[ids.ID, *BlockWrapper]
+	// stopSweep is closed by [Close] to stop the sweep of [unverifiedLRU]. It
+	// is nil if there is no sweep.
+	stopSweep chan struct{}
 	// missingBlocks is an LRU cache of missing blocks
 	missingBlocks cache.Cacher[ids.ID, struct{}]
 	// string([byte repr. of block]) --> the block's ID
-	bytesToIDCache    cache.Cacher[string, ids.ID]
-	lastAcceptedBlock *BlockWrapper
-}
+	bytesToIDCache cache.Cacher[string, ids.ID]
+	// options is an LRU cache of the wrapped options of oracle blocks, keyed
+	// by the ID of the oracle block.
+	options cache.Cacher[ids.ID, [2]*BlockWrapper]
+	// optionsN is an LRU cache of the wrapped options of [OracleBlockN]s,
+	// keyed by the ID of the oracle block.
+	optionsN cache.Cacher[ids.ID, []block.Block]
+	// shouldVerifyWithContext is an LRU cache of the results of
+	// ShouldVerifyWithContext of undecided blocks.
+	shouldVerifyWithContext cache.Cacher[ids.ID, shouldVerifyWithContextResult]
+	// failedVerifications is an LRU cache of the permanent verification
+	// failures of blocks.
+	failedVerifications cache.Cacher[ids.ID, error]
+	// permanentVerifyErrors is set by [Config.PermanentVerifyErrors].
+	permanentVerifyErrors []error
+	// isTemporaryVerifyError is set by [Config.IsTemporaryVerifyError].
+	isTemporaryVerifyError func(error) bool
+	// maxVerifyRetries is set by [Config.MaxVerifyRetries].
+	maxVerifyRetries int
+	// verifyRetryBackoff is set by [Config.VerifyRetryBackoff].
+	verifyRetryBackoff time.Duration
+	// pending is nil unless [Config.MaxPendingBlocks] is set.
+	pending *pendingBlocks
+	// missingParentErr is set by [Config.MissingParentErr].
+	missingParentErr error
+	// acceptedHeights is an LRU cache of the IDs of accepted blocks, keyed by
+	// their height.
+	acceptedHeights cache.Cacher[uint64, ids.ID]
+	// decidedStore is set by [Config.DecidedStore].
+	decidedStore DecidedStore
+	// children is nil unless [Config.ChildrenIndexDepth] is set.
+	children *childrenIndex
+	// getBlockIDAtHeight is set by [Config.GetBlockIDAtHeight].
+	getBlockIDAtHeight func(context.Context, uint64) (ids.ID, error)
+	lastAcceptedBlock  *BlockWrapper
+	// preference is the block most recently preferred by consensus, set by
+	// [State.SetPreference]. It is protected by [lock].
+	preference ids.ID
 
-// Config defines all of the parameters necessary to initialize State
-type Config struct {
-	// Cache configuration:
-	DecidedCacheSize, MissingCacheSize, UnverifiedCacheSize, BytesToIDCacheSize int
+	// log is set by [Config.Log].
+	log log.Logger
+	// tracer is set by [Config.Tracer].
+	tracer Tracer
 
-	LastAcceptedBlock     block.Block
-	GetBlock              func(context.Context, ids.ID) (block.Block, error)
-	UnmarshalBlock        func(context.Context, []byte) (block.Block, error)
-	BatchedUnmarshalBlock func(context.Context, [][]byte) ([]block.Block, error)
-	BuildBlock            func(context.Context) (block.Block, error)
-	BuildBlockWithContext func(context.Context, *block.Context) (block.Block, error)
+	// metrics is nil unless the State was created by [NewMeteredState].
+	metrics *stateMetrics
 }
 
 func (s *State) initialize(config *Config) {
-	s.verifiedBlocks = make(map[ids.ID]*BlockWrapper)
+	s.verifiedBlocks = config.VerifiedMap.newVerifiedBlocks()
+	s.keyFunc = config.KeyFunc
+	s.options = lru.NewCache[ids.ID, [2]*BlockWrapper](optionsCacheSize)
+	s.optionsN = lru.NewCache[ids.ID, []block.Block](optionsCacheSize)
+	s.shouldVerifyWithContext = lru.NewCache[ids.ID, shouldVerifyWithContextResult](shouldVerifyWithContextCacheSize)
+	s.acceptedHeights = lru.NewCache[uint64, ids.ID](config.HeightIndexCacheSize)
+	s.failedVerifications = lru.NewCache[ids.ID, error](config.FailedVerifyCacheSize)
+	s.permanentVerifyErrors = config.PermanentVerifyErrors
+	s.isTemporaryVerifyError = config.IsTemporaryVerifyError
+	s.maxVerifyRetries = config.MaxVerifyRetries
+	s.verifyRetryBackoff = config.VerifyRetryBackoff
+	if config.MaxPendingBlocks > 0 && config.MissingParentErr != nil {
+		s.pending = newPendingBlocks(config.MaxPendingBlocks)
+	}
+	s.missingParentErr = config.MissingParentErr
+	s.getBlockIDAtHeight = config.GetBlockIDAtHeight
+	if config.ChildrenIndexDepth > 0 {
+		s.children = newChildrenIndex(config.ChildrenIndexDepth)
+	}
+	s.decidedStore = config.DecidedStore
 	s.getBlock = config.GetBlock
 	s.buildBlock = config.BuildBlock
 	s.buildBlockWithContext = config.BuildBlockWithContext
 	s.unmarshalBlock = config.UnmarshalBlock
 	s.batchedUnmarshalBlock = config.BatchedUnmarshalBlock
-	s.lastAcceptedBlock = &BlockWrapper{
-		Block: config.LastAcceptedBlock,
-		state: s,
+	s.maxProcessing = config.MaxProcessing
+	if !config.DisableDecidedCache {
+		s.decidedCacheSize = config.DecidedCacheSize
+	}
+	s.unverifiedCacheSize = config.UnverifiedCacheSize
+	if config.MaxConcurrentVerify > 0 {
+		s.verifySlots = semaphore.NewWeighted(int64(config.MaxConcurrentVerify))
+	}
+	s.cascadeReject = config.CascadeReject
+	s.autoOrphanCleanup = config.AutoOrphanCleanup
+	s.checkHeightContinuity = config.CheckHeightContinuity
+	s.strictParents = config.StrictParents
+	s.disableDecidedCache = config.DisableDecidedCache
+	s.disableRejectedCache = config.DisableRejectedCache
+	s.shareOptionParentState = config.ShareOptionParentState
+	s.readOnly = config.ReadOnly
+	if s.readOnly {
+		s.readOnlyVerified = make(map[ids.ID]*BlockWrapper)
+	}
+	s.trustedRehydrate = config.TrustedRehydrate
+	s.strictVerifyContext = config.StrictVerifyContext
+	s.validateContext = config.ValidateContext
+	s.acceptedNotifier = newAcceptedNotifier(config.AcceptedChSize)
+	s.onAccept = config.OnAccept
+	s.decisionTimeout = config.DecisionTimeout
+	s.provideParentState = config.ProvideParentState
+	s.preVerify = config.PreVerify
+	s.log = config.Log
+	s.tracer = config.Tracer
+	if s.log == nil {
+		s.log = log.NewNoOpLogger()
+	}
+	if config.LastAcceptedBlock != nil {
+		s.lastAcceptedBlock = s.newBlockWrapper(config.LastAcceptedBlock)
+		s.decidedBlocks.Put(s.key(config.LastAcceptedBlock), decidedBlock{
+			BlockWrapper: s.lastAcceptedBlock,
+			accepted:     true,
+		})
+		s.acceptedHeights.Put(config.LastAcceptedBlock.Height(), s.key(config.LastAcceptedBlock))
+		s.metrics.setLastAccepted(config.LastAcceptedBlock)
+	}
+	if config.UnverifiedTTL > 0 {
+		s.stopSweep = make(chan struct{})
+		go s.sweepUnverified(config.UnverifiedTTL)
+	}
+}
+
+func newUnverifiedCache(config *Config) *lruCache[ids.ID, *BlockWrapper] {
+	return newExpiringLRUCache(
+		config.UnverifiedCacheSize,
+		cachedBlockSize,
+		onEvictUnverified(config.OnEvict),
+		config.UnverifiedTTL,
+		time.Now,
+	)
+}
+
+// sweepUnverified evicts expired unverified blocks every [interval] until
+// [stopSweep] is closed.
+func (s *State) sweepUnverified(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.unverifiedLRU.expire()
+		case <-s.stopSweep:
+			return
+		}
 	}
-	s.decidedBlocks.Put(config.LastAcceptedBlock.ID(), s.lastAcceptedBlock)
 }
 
-func NewState(config *Config) *State {
+func NewState(config *Config) (*State, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	decidedEntries := config.DecidedEvictionPolicy.newCache(config.DecidedCacheSize, onEvictDecided(config.OnEvict))
+	unverifiedLRU := newUnverifiedCache(config)
 	c := &State{
-		verifiedBlocks:   make(map[ids.ID]*BlockWrapper),
-		decidedBlocks:    lru.NewSizedCache(config.DecidedCacheSize, cachedBlockSize),
+		decidedBlocks:    newPinnedDecidedCache(decidedEntries),
+		decidedEntries:   decidedEntries,
 		missingBlocks:    lru.NewCache[ids.ID, struct{}](config.MissingCacheSize),
-		unverifiedBlocks: lru.NewSizedCache(config.UnverifiedCacheSize, cachedBlockSize),
+		unverifiedBlocks: unverifiedLRU,
+		unverifiedLRU:    unverifiedLRU,
 		bytesToIDCache:   lru.NewSizedCache(config.BytesToIDCacheSize, cachedBlockBytesSize),
 	}
 	c.initialize(config)
-	return c
+	return c, nil
 }
 
 func NewMeteredState(
 	registerer metric.Registerer,
 	config *Config,
 ) (*State, error) {
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	stateMetrics, err := newStateMetrics(registerer)
+	if err != nil {
+		return nil, err
+	}
 	registry := registerer.(metric.Registry)
-	decidedCache, err := metercacher.New[ids.ID, *BlockWrapper](
+	decidedEntries := config.DecidedEvictionPolicy.newCache(config.DecidedCacheSize, onEvictDecided(config.OnEvict))
+	decidedCache, err := metercacher.New(
 		"decided_cache",
 		registry,
-		lru.NewSizedCache(config.DecidedCacheSize, cachedBlockSize),
+		meterCacheBytes(
+			stateMetrics,
+			decidedLabel,
+			config.DecidedCacheSize,
+			decidedEntries,
+		),
 	)
 	if err != nil {
 		return nil, err
@@ -120,10 +368,16 @@ func NewMeteredState(
 	if err != nil {
 		return nil, err
 	}
-	unverifiedCache, err := metercacher.New[ids.ID, *BlockWrapper](
+	unverifiedLRU := newUnverifiedCache(config)
+	unverifiedCache, err := metercacher.New(
 		"unverified_cache",
 		registry,
-		lru.NewSizedCache(config.UnverifiedCacheSize, cachedBlockSize),
+		meterCacheBytes(
+			stateMetrics,
+			unverifiedLabel,
+			config.UnverifiedCacheSize,
+			unverifiedLRU,
+		),
 	)
 	if err != nil {
 		return nil, err
@@ -137,27 +391,47 @@ func NewMeteredState(
 		return nil, err
 	}
 	c := &State{
-		verifiedBlocks:   make(map[ids.ID]*BlockWrapper),
-		decidedBlocks:    decidedCache,
+		decidedBlocks:    newPinnedDecidedCache(decidedCache),
+		decidedEntries:   decidedEntries,
 		missingBlocks:    missingCache,
 		unverifiedBlocks: unverifiedCache,
+		unverifiedLRU:    unverifiedLRU,
 		bytesToIDCache:   bytesToIDCache,
+		metrics:          stateMetrics,
 	}
 	c.initialize(config)
 	return c, nil
 }
 
-var errSetAcceptedWithProcessing = errors.New("cannot set last accepted block with blocks processing")
+var (
+	// ErrClosed is returned when verifying or deciding a block after the State
+	// was closed.
+	ErrClosed = errors.New("state closed")
+
+	errSetAcceptedWithProcessing = errors.New("cannot set last accepted block with blocks processing")
+	errRehydrateNotTrusted       = errors.New("rehydrate is not trusted")
+	errAlreadyInitialized        = errors.New("state already initialized")
+	errEvictLastAccepted         = errors.New("cannot evict the last accepted block")
+	errReadOnly                  = errors.New("state is read-only")
+	errNotReadOnly               = errors.New("state is not read-only")
+	errNotVerified               = errors.New("block is not verified")
+	errNilBlock                  = errors.New("parsed nil block")
+)
 
 // SetLastAcceptedBlock sets the last accepted block to [lastAcceptedBlock].
 // This should be called with an internal block - not a wrapped block returned
 // from state.
 //
 // This also flushes [lastAcceptedBlock] from missingBlocks and unverifiedBlocks
-// to ensure that their contents stay valid.
+// to ensure that their contents stay valid. If the last accepted block doesn't
+// move forward, the accepted heights indexed by [State.GetBlockIDAtHeight] are
+// flushed, as they may refer to blocks above the new last accepted block or on
+// another chain.
 func (s *State) SetLastAcceptedBlock(lastAcceptedBlock block.Block) error {
-	if len(s.verifiedBlocks) != 0 {
-		return fmt.Errorf("%w: %d", errSetAcceptedWithProcessing, len(s.verifiedBlocks))
+	s.lock.Lock()
+	if numProcessing := s.verifiedBlocks.Len(); numProcessing != 0 {
+		s.lock.Unlock()
+		return fmt.Errorf("%w: %d", errSetAcceptedWithProcessing, numProcessing)
 	}
 
 	// [lastAcceptedBlock] is no longer missing or unverified, so we evict it from the corresponding
@@ -165,27 +439,257 @@ func (s *State) SetLastAcceptedBlock(lastAcceptedBlock block.Block) error {
 	//
 	// Note: there's no need to evict from the decided blocks cache or bytesToIDCache since their
 	// contents will still be valid.
-	lastAcceptedBlockID := lastAcceptedBlock.ID()
+	lastAcceptedBlockID := s.key(lastAcceptedBlock)
 	s.missingBlocks.Evict(lastAcceptedBlockID)
 	s.unverifiedBlocks.Evict(lastAcceptedBlockID)
-	s.lastAcceptedBlock = &BlockWrapper{
-		Block: lastAcceptedBlock,
-		state: s,
+	if s.lastAcceptedBlock != nil && lastAcceptedBlock.Height() <= s.lastAcceptedBlock.Height() {
+		s.acceptedHeights.Flush()
 	}
-	s.decidedBlocks.Put(lastAcceptedBlockID, s.lastAcceptedBlock)
+	wrappedBlk := s.newBlockWrapper(lastAcceptedBlock)
+	s.lastAcceptedBlock = wrappedBlk
+	s.lock.Unlock()
 
+	// The decided blocks may call [Config.OnEvict], so [s.lock] must not be
+	// held.
+	s.decidedBlocks.Put(lastAcceptedBlockID, decidedBlock{
+		BlockWrapper: wrappedBlk,
+		accepted:     true,
+	})
+	s.acceptedHeights.Put(lastAcceptedBlock.Height(), lastAcceptedBlockID)
+	s.metrics.setLastAccepted(lastAcceptedBlock)
+	return nil
+}
+
+// Initialize sets the last accepted block of a State that was created without
+// [Config.LastAcceptedBlock]. This should be called with an internal block -
+// not a wrapped block returned from state.
+//
+// Initialize returns an error if the last accepted block was already set,
+// either by [Config.LastAcceptedBlock] or by a previous call to Initialize.
+// Use [State.SetLastAcceptedBlock] to change the last accepted block instead.
+func (s *State) Initialize(ctx context.Context, lastAcceptedBlock block.Block) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return ErrClosed
+	}
+	if s.lastAcceptedBlock != nil {
+		s.lock.Unlock()
+		return fmt.Errorf("%w: last accepted block %s", errAlreadyInitialized, s.lastAcceptedBlock.ID())
+	}
+
+	lastAcceptedBlockID := s.key(lastAcceptedBlock)
+	wrappedBlk := s.newBlockWrapper(lastAcceptedBlock)
+	s.lastAcceptedBlock = wrappedBlk
+	s.lock.Unlock()
+
+	// The decided blocks may call [Config.OnEvict], so [s.lock] must not be
+	// held.
+	s.decidedBlocks.Put(lastAcceptedBlockID, decidedBlock{
+		BlockWrapper: wrappedBlk,
+		accepted:     true,
+	})
+	s.acceptedHeights.Put(lastAcceptedBlock.Height(), lastAcceptedBlockID)
+	s.metrics.setLastAccepted(lastAcceptedBlock)
+	return nil
+}
+
+// Close marks the State as closed and drops all of its cached blocks. Verify,
+// Accept and Reject calls made after Close return [ErrClosed]. Verifications
+// that are already running are allowed to complete, but their blocks are not
+// cached. The channel returned by [State.AcceptedCh] is closed.
+//
+// The last accepted block is retained.
+func (s *State) Close() error {
+	s.lock.Lock()
+	if !s.closed && s.stopSweep != nil {
+		close(s.stopSweep)
+	}
+	s.closed = true
+	s.verifiedBlocks.Range(func(_ ids.ID, bw *BlockWrapper) bool {
+		s.unpinParent(bw)
+		return true
+	})
+	s.verifiedBlocks.Clear()
+	s.metrics.setProcessing(0)
+	clear(s.readOnlyVerified)
+	s.lock.Unlock()
+
+	s.acceptedNotifier.close()
+	s.Flush()
 	return nil
 }
 
 // Flush each block cache
 func (s *State) Flush() {
+	s.options.Flush()
+	s.optionsN.Flush()
+	s.shouldVerifyWithContext.Flush()
+	s.acceptedHeights.Flush()
+	s.failedVerifications.Flush()
+	if s.pending != nil {
+		s.pending.clear()
+		s.metrics.setPending(0)
+	}
 	s.decidedBlocks.Flush()
 	s.missingBlocks.Flush()
 	s.unverifiedBlocks.Flush()
 	s.bytesToIDCache.Flush()
 }
 
-// GetBlock returns the BlockWrapper as block.Block corresponding to [blkID]
+// Evict removes [blkID] from the verified, decided and unverified blocks under
+// a single acquisition of the State lock, such as to roll back a block. The
+// block is also no longer kept resident as the decided parent of verified
+// blocks. [Config.OnEvict] is not called with the evicted block.
+//
+// The last accepted block can't be evicted, in which case an error is
+// returned and no cache is modified.
+func (s *State) Evict(blkID ids.ID) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.lastAcceptedBlock != nil && s.lastAcceptedBlock.key() == blkID {
+		return fmt.Errorf("%w: %s", errEvictLastAccepted, blkID)
+	}
+	s.removeVerified(blkID)
+	s.decidedBlocks.Evict(blkID)
+	s.decidedBlocks.drop(blkID)
+	s.unverifiedBlocks.Evict(blkID)
+	return nil
+}
+
+// PruneDecidedBelow evicts the cached decided blocks whose height is below
+// [height] and returns the number of blocks evicted. The last accepted block
+// is never evicted. [Config.OnEvict] is not called with the evicted blocks.
+//
+// Evicted blocks that are the parent of a verified block remain resident until
+// their verified children are decided. They are not counted as evicted.
+func (s *State) PruneDecidedBelow(height uint64) int {
+	lastAcceptedKey := s.lastAcceptedKey()
+
+	var pruned []ids.ID
+	s.decidedEntries.each(func(blkID ids.ID, blk decidedBlock) {
+		if blk.Height() < height && blkID != lastAcceptedKey {
+			pruned = append(pruned, blkID)
+		}
+	})
+	var numPruned int
+	for _, blkID := range pruned {
+		s.decidedBlocks.Evict(blkID)
+		if !s.decidedBlocks.isPinned(blkID) {
+			numPruned++
+		}
+	}
+	return numPruned
+}
+
+// DecidedInRange returns the cached decided blocks, accepted or rejected,
+// whose height is in [lo, hi], sorted by height and then by ID. Blocks that
+// aren't cached are omitted, so the result may have gaps that the caller must
+// fill from storage.
+func (s *State) DecidedInRange(lo, hi uint64) []block.Block {
+	if lo > hi {
+		return nil
+	}
+
+	var blks []block.Block
+	seen := make(map[ids.ID]struct{})
+	add := func(blkID ids.ID, blk decidedBlock) {
+		if _, ok := seen[blkID]; ok {
+			return
+		}
+		if height := blk.Height(); height >= lo && height <= hi {
+			seen[blkID] = struct{}{}
+			blks = append(blks, blk.BlockWrapper)
+		}
+	}
+	s.decidedEntries.each(add)
+	s.decidedBlocks.eachPinned(add)
+	sortByHeight(blks)
+	return blks
+}
+
+// Trim evicts decided and unverified blocks until the estimated footprint of
+// these caches is at most [targetBytes], and returns the number of blocks
+// evicted. Decided blocks are evicted before unverified blocks. Unverified
+// blocks, and decided blocks under [LRUPolicy] and [TTLPolicy], are evicted
+// least recently used first. Under [NoEvictionPolicy], decided blocks are
+// evicted in no particular order. Verified blocks and the last accepted block
+// are never evicted. [Config.OnEvict] is not called with the evicted blocks.
+//
+// The footprint is estimated from the size of the block bytes and IDs, as for
+// the cache sizes in [Config]. It does not account for the memory otherwise
+// held by the underlying blocks, nor for the other caches of State. Evicted
+// blocks are only freed once they are no longer referenced, such as by the VM
+// or consensus, and the garbage collector runs. Decided blocks that are the
+// parent of a verified block remain resident until their verified children
+// are decided, so they are not evicted and remain part of the footprint.
+func (s *State) Trim(targetBytes int64) int {
+	lastAcceptedKey := s.lastAcceptedKey()
+
+	var (
+		decided    []evictedEntry[ids.ID, decidedBlock]
+		unverified []evictedEntry[ids.ID, *BlockWrapper]
+	)
+	s.decidedEntries.each(func(blkID ids.ID, blk decidedBlock) {
+		if blkID != lastAcceptedKey {
+			decided = append(decided, evictedEntry[ids.ID, decidedBlock]{key: blkID, value: blk})
+		}
+	})
+	s.unverifiedLRU.each(func(blkID ids.ID, bw *BlockWrapper) {
+		unverified = append(unverified, evictedEntry[ids.ID, *BlockWrapper]{key: blkID, value: bw})
+	})
+
+	var (
+		footprint  = s.footprint()
+		numEvicted int
+	)
+	for _, e := range decided {
+		if footprint <= targetBytes {
+			return numEvicted
+		}
+		if s.decidedBlocks.isPinned(e.key) {
+			continue
+		}
+		s.decidedBlocks.Evict(e.key)
+		footprint -= int64(cachedDecidedBlockSize(e.key, e.value))
+		numEvicted++
+	}
+	for _, e := range unverified {
+		if footprint <= targetBytes {
+			return numEvicted
+		}
+		s.unverifiedBlocks.Evict(e.key)
+		footprint -= int64(cachedBlockSize(e.key, e.value))
+		numEvicted++
+	}
+	return numEvicted
+}
+
+// footprint returns the estimated footprint of the decided and unverified
+// blocks caches, as used by [State.Trim].
+func (s *State) footprint() int64 {
+	var footprint int64
+	s.decidedEntries.each(func(blkID ids.ID, blk decidedBlock) {
+		footprint += int64(cachedDecidedBlockSize(blkID, blk))
+	})
+	s.unverifiedLRU.each(func(blkID ids.ID, bw *BlockWrapper) {
+		footprint += int64(cachedBlockSize(blkID, bw))
+	})
+	return footprint
+}
+
+// GetBlock returns the BlockWrapper as block.Block corresponding to [blkID].
+//
+// The caches are consulted in the order verifiedBlocks, decidedBlocks,
+// unverifiedBlocks and missingBlocks, followed by [Config.DecidedStore], before
+// falling back to [Config.GetBlock]. A block loaded from the VM is cached as
+// decided if it is at or below the last accepted height and as unverified
+// otherwise.
 func (s *State) GetBlock(ctx context.Context, blkID ids.ID) (block.Block, error) {
 	if blk, ok := s.getCachedBlock(blkID); ok {
 		return blk, nil
@@ -195,10 +699,15 @@ func (s *State) GetBlock(ctx context.Context, blkID ids.ID) (block.Block, error)
 		return nil, database.ErrNotFound
 	}
 
+	if blk, ok := s.getStoredBlock(ctx, blkID); ok {
+		return s.addBlockOutsideConsensus(blk), nil
+	}
+
 	blk, err := s.getBlock(ctx, blkID)
 	// If getBlock returns [database.ErrNotFound], State considers
-	// this a cacheable miss.
-	if err == database.ErrNotFound {
+	// this a cacheable miss until a block with this ID is parsed, verified
+	// or accepted.
+	if errors.Is(err, database.ErrNotFound) {
 		s.missingBlocks.Put(blkID, struct{}{})
 		return nil, err
 	} else if err != nil {
@@ -213,15 +722,27 @@ func (s *State) GetBlock(ctx context.Context, blkID ids.ID) (block.Block, error)
 // getCachedBlock checks the caches for [blkID] by priority. Returning
 // true if [blkID] is found in one of the caches.
 func (s *State) getCachedBlock(blkID ids.ID) (block.Block, bool) {
-	if blk, ok := s.verifiedBlocks[blkID]; ok {
+	blk, ok := s.verifiedBlocks.Get(blkID)
+	s.metrics.verifiedLookup(ok)
+	if ok {
 		return blk, true
 	}
 
-	if blk, ok := s.decidedBlocks.Get(blkID); ok {
-		return blk, true
+	decidedBlk, ok := s.decidedBlocks.Get(blkID)
+	s.metrics.decidedLookup(ok)
+	if ok {
+		return decidedBlk.BlockWrapper, true
+	}
+	// Without a decided cache, the last accepted block is only held by State.
+	if s.disableDecidedCache {
+		if lastAcceptedBlock := s.LastAcceptedBlock(); lastAcceptedBlock != nil && lastAcceptedBlock.key() == blkID {
+			return lastAcceptedBlock, true
+		}
 	}
 
-	if blk, ok := s.unverifiedBlocks.Get(blkID); ok {
+	blk, ok = s.unverifiedBlocks.Get(blkID)
+	s.metrics.unverifiedLookup(ok)
+	if ok {
 		return blk, true
 	}
 
@@ -239,24 +760,57 @@ func (s *State) GetBlockInternal(ctx context.Context, blkID ids.ID) (block.Block
 }
 
 // ParseBlock attempts to parse [b] into an internal Block and adds it to the
-// appropriate caching layer if successful.
+// appropriate caching layer if successful. If a block with the same ID is
+// already cached, the cached block is returned, unless it isn't encoded as
+// [b], in which case an error is returned.
 func (s *State) ParseBlock(ctx context.Context, b []byte) (block.Block, error) {
+	return s.parseBlock(ctx, b, s.unmarshalBlock)
+}
+
+// ParseVerify parses [b] with [parse] and verifies the resulting block,
+// going through the same caching as [State.ParseBlock] and
+// [BlockWrapper.Verify]. It is intended to be used by fuzz tests of a VM's
+// blocks, so any error, including [parse] returning a nil block, is returned
+// rather than panicking.
+func (s *State) ParseVerify(ctx context.Context, b []byte, parse func([]byte) (block.Block, error)) error {
+	blk, err := s.parseBlock(ctx, b, func(_ context.Context, b []byte) (block.Block, error) {
+		return parse(b)
+	})
+	if err != nil {
+		return err
+	}
+	return blk.Verify(ctx)
+}
+
+// parseBlock implements [State.ParseBlock] using [unmarshalBlock] to parse
+// blocks that aren't cached.
+func (s *State) parseBlock(
+	ctx context.Context,
+	b []byte,
+	unmarshalBlock func(context.Context, []byte) (block.Block, error),
+) (block.Block, error) {
 	// See if we've cached this block's ID by its byte repr.
 	cachedBlkID, blkIDCached := s.bytesToIDCache.Get(string(b))
 	if blkIDCached {
 		// See if we have this block cached
 		if cachedBlk, ok := s.getCachedBlock(cachedBlkID); ok {
+			if err := checkBytes(cachedBlkID, cachedBlk, b); err != nil {
+				return nil, err
+			}
 			return cachedBlk, nil
 		}
 	}
 
 	// We don't have this block cached by its byte repr.
 	// Parse the block from bytes
-	blk, err := s.unmarshalBlock(ctx, b)
+	blk, err := unmarshalBlock(ctx, b)
 	if err != nil {
 		return nil, err
 	}
-	blkID := blk.ID()
+	if blk == nil {
+		return nil, errNilBlock
+	}
+	blkID := s.key(blk)
 	s.bytesToIDCache.Put(string(b), blkID)
 
 	// Only check the caches if we didn't do so above
@@ -265,6 +819,9 @@ func (s *State) ParseBlock(ctx context.Context, b []byte) (block.Block, error) {
 		// if processing or simply allow this block to be immediately
 		// garbage collected if it is already cached.
 		if cachedBlk, ok := s.getCachedBlock(blkID); ok {
+			if err := checkBytes(blkID, cachedBlk, b); err != nil {
+				return nil, err
+			}
 			return cachedBlk, nil
 		}
 	}
@@ -295,6 +852,9 @@ func (s *State) BatchedParseBlock(ctx context.Context, blksBytes [][]byte) ([]bl
 
 		// See if we have this block cached
 		if cachedBlk, ok := s.getCachedBlock(blkID); ok {
+			if err := checkBytes(blkID, cachedBlk, blkBytes); err != nil {
+				return nil, err
+			}
 			blks[i] = cachedBlk
 		} else {
 			unparsedBlksBytes = append(unparsedBlksBytes, blkBytes)
@@ -332,7 +892,7 @@ func (s *State) BatchedParseBlock(ctx context.Context, blksBytes [][]byte) ([]bl
 			}
 		}
 
-		blkID := blk.ID()
+		blkID := s.key(blk)
 		if !idWasCached[i] {
 			blkBytes := blk.Bytes()
 			blkBytesStr := string(blkBytes)
@@ -342,6 +902,9 @@ func (s *State) BatchedParseBlock(ctx context.Context, blksBytes [][]byte) ([]bl
 			// if processing or simply allow this block to be immediately
 			// garbage collected if it is already cached.
 			if cachedBlk, ok := s.getCachedBlock(blkID); ok {
+				if err := checkBytes(blkID, cachedBlk, blkBytes); err != nil {
+					return nil, err
+				}
 				blks[i] = cachedBlk
 				continue
 			}
@@ -357,6 +920,9 @@ func (s *State) BatchedParseBlock(ctx context.Context, blksBytes [][]byte) ([]bl
 // adds it to the appropriate caching layer if successful.
 // If [s.buildBlockWithContext] is nil, returns [BuildBlock].
 func (s *State) BuildBlockWithContext(ctx context.Context, blockCtx *block.Context) (block.Block, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
 	if s.buildBlockWithContext == nil {
 		return s.BuildBlock(ctx)
 	}
@@ -372,6 +938,9 @@ func (s *State) BuildBlockWithContext(ctx context.Context, blockCtx *block.Conte
 // BuildBlock attempts to build a new internal Block, wraps it, and adds it
 // to the appropriate caching layer if successful.
 func (s *State) BuildBlock(ctx context.Context) (block.Block, error) {
+	if s.readOnly {
+		return nil, errReadOnly
+	}
 	blk, err := s.buildBlock(ctx)
 	if err != nil {
 		return nil, err
@@ -381,7 +950,7 @@ func (s *State) BuildBlock(ctx context.Context) (block.Block, error) {
 }
 
 func (s *State) deduplicate(blk block.Block) block.Block {
-	blkID := blk.ID()
+	blkID := s.key(blk)
 	// Defensive: buildBlock should not return a block that has already been verified.
 	// If it does, make sure to return the existing reference to the block.
 	if existingBlk, ok := s.getCachedBlock(blkID); ok {
@@ -395,43 +964,613 @@ func (s *State) deduplicate(blk block.Block) block.Block {
 	return s.addBlockOutsideConsensus(blk)
 }
 
+// WrapBlock returns the canonical wrapper of [blk], ensuring that consensus
+// only ever sees one wrapper per block ID. If a wrapper for [blk]'s ID is
+// already cached it is returned, otherwise [blk] is wrapped and added to the
+// appropriate cache. As [blk] is provided by the VM rather than parsed, its ID
+// is trusted and its bytes aren't compared to those of the cached wrapper.
+func (s *State) WrapBlock(blk block.Block) *BlockWrapper {
+	if bw, ok := blk.(*BlockWrapper); ok && bw.state == s {
+		blk = bw.Block
+	}
+	return s.deduplicate(blk).(*BlockWrapper)
+}
+
+// VerifyAndGet wraps and verifies [blk], and returns the canonical wrapper of
+// [blk] once it is verified. If the block was already verified through another
+// wrapper, that wrapper is returned.
+func (s *State) VerifyAndGet(ctx context.Context, blk block.Block) (*BlockWrapper, error) {
+	bw := s.WrapBlock(blk)
+	if err := bw.Verify(ctx); err != nil {
+		return nil, err
+	}
+	if verifiedBlk, ok := s.verifiedBlocks.Get(bw.key()); ok {
+		return verifiedBlk, nil
+	}
+	return bw, nil
+}
+
+// WrapStrictContextBlock returns the canonical wrapper of [blk], as
+// [WrapBlock], marked so that it is only ever verified with VerifyWithContext.
+// Its ShouldVerifyWithContext always returns true, its VerifyWithContext never
+// falls back to Verify, and its Verify calls the underlying VerifyWithContext
+// with a nil block context. The wrapper remains strict for as long as it is
+// cached.
+//
+// WrapStrictContextBlock panics if [blk] is not a block.Block, or if it is a
+// wrapper whose underlying block does not implement block.WithVerifyContext,
+// so that VMs requiring context verification detect such blocks when they are
+// wrapped rather than when they are verified.
+func (s *State) WrapStrictContextBlock(blk block.WithVerifyContext) *BlockWrapper {
+	b, ok := blk.(block.Block)
+	if !ok {
+		panic(fmt.Sprintf("chain: %T does not implement block.Block", blk))
+	}
+	bw := s.WrapBlock(b)
+	if _, ok := bw.Block.(block.WithVerifyContext); !ok {
+		panic(fmt.Sprintf("chain: %T does not implement block.WithVerifyContext", bw.Block))
+	}
+	bw.strictContext.Store(true)
+	return bw
+}
+
+// BuildOracleOptions returns the canonical wrappers of the options of [blk].
+// The options are cached with the wrapper of [blk], and each option is added
+// to the unverified blocks so that it is ready to be verified once consensus
+// picks it. This is equivalent to calling Options on the wrapper of [blk].
+func (s *State) BuildOracleOptions(ctx context.Context, blk OracleBlock) ([2]*BlockWrapper, error) {
+	return s.WrapBlock(blk).options(ctx)
+}
+
+// VerifyDryRun verifies [blk], after running [Config.PreVerify], without
+// touching any cache. If [blk] is a wrapper returned by State, its underlying
+// block is verified, even if the block is already processing.
+func (s *State) VerifyDryRun(ctx context.Context, blk block.Block) error {
+	if bw, ok := blk.(*BlockWrapper); ok && bw.state == s {
+		blk = bw.Block
+	}
+	if s.preVerify != nil {
+		if err := s.preVerify(ctx, blk); err != nil {
+			return err
+		}
+	}
+	return blk.Verify(ctx)
+}
+
+// Rehydrate adds [blk], which must have been verified before the node
+// restarted, to the processing blocks without verifying it again. The
+// canonical wrapper of [blk] is returned.
+//
+// Rehydrate fails unless [Config.TrustedRehydrate] is set. Blocks that are
+// already decided are never rehydrated.
+func (s *State) Rehydrate(ctx context.Context, blk block.Block) (*BlockWrapper, error) {
+	if !s.trustedRehydrate {
+		return nil, errRehydrateNotTrusted
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	bw := s.WrapBlock(blk)
+	if err := s.addVerified(bw); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// ReportAccepted accepts the block [blkID], which was reported accepted by the
+// feed of accepted blocks of a read-only State. See [Config.ReadOnly].
+//
+// The block must have been verified, and its parent must still be the last
+// accepted block.
+func (s *State) ReportAccepted(ctx context.Context, blkID ids.ID) error {
+	if !s.readOnly {
+		return errNotReadOnly
+	}
+
+	s.lock.RLock()
+	bw, ok := s.readOnlyVerified[blkID]
+	lastAccepted := ok && s.isLastAccepted(bw.Parent())
+	s.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", errNotVerified, blkID)
+	}
+	if !lastAccepted {
+		return fmt.Errorf("%w: %s", errMissingParent, bw.Parent())
+	}
+	return bw.Accept(ctx)
+}
+
+// markReadOnlyVerified records that [bw] passed verification in read-only
+// mode, so that it can be accepted by [State.ReportAccepted].
+func (s *State) markReadOnlyVerified(bw *BlockWrapper) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// The state may have been closed while the block was being verified.
+	if s.closed {
+		return ErrClosed
+	}
+	// The last accepted block may have changed in the meantime.
+	if !s.isLastAccepted(bw.Parent()) {
+		return fmt.Errorf("%w: %s", errMissingParent, bw.Parent())
+	}
+	s.readOnlyVerified[bw.key()] = bw
+	return nil
+}
+
+// addVerified adds [bw] to the processing blocks without verifying it. Blocks
+// that are already decided are refused.
+func (s *State) addVerified(bw *BlockWrapper) error {
+	if s.readOnly {
+		return errReadOnly
+	}
+	blkID := bw.key()
+	if _, ok := s.decidedBlocks.Get(blkID); ok {
+		return fmt.Errorf("%w: %s", errBlockAlreadyDecided, blkID)
+	}
+	parent, parentDecided := s.decidedParent(bw)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	s.unverifiedBlocks.Evict(blkID)
+	s.missingBlocks.Evict(blkID)
+	if verifiedBlk, ok := s.verifiedBlocks.Get(blkID); ok {
+		s.unpinParent(verifiedBlk)
+	}
+	bw.verifiedAt = time.Now()
+	s.verifiedBlocks.Put(blkID, bw)
+	s.pinParent(bw, parent, parentDecided)
+	s.metrics.setProcessing(s.verifiedBlocks.Len())
+	return nil
+}
+
+// key returns the key of [blk] in the block caches.
+func (s *State) key(blk block.Block) ids.ID {
+	if s.keyFunc == nil {
+		return blk.ID()
+	}
+	return s.keyFunc(blk)
+}
+
+// newBlockWrapper wraps [blk] without adding it to any cache.
+func (s *State) newBlockWrapper(blk block.Block) *BlockWrapper {
+	return &BlockWrapper{
+		Block: blk,
+		state: s,
+	}
+}
+
+// decidedBlock is a block cached in decidedBlocks along with its decision.
+type decidedBlock struct {
+	*BlockWrapper
+
+	accepted bool
+}
+
+// checkBytes returns an error if [cachedBlk], the cached block [blkID], isn't
+// encoded as [b]. Blocks are deduplicated by ID, so a different encoding of a
+// cached block must not be silently replaced by the cached block.
+func checkBytes(blkID ids.ID, cachedBlk block.Block, b []byte) error {
+	if !bytes.Equal(cachedBlk.Bytes(), b) {
+		return fmt.Errorf("%w: %s", errConflictingBytes, blkID)
+	}
+	return nil
+}
+
 // addBlockOutsideConsensus adds [blk] to the correct cache and returns
 // a wrapped version of [blk]
 // assumes [blk] is a known, non-wrapped block that is not currently
 // in consensus. [blk] could be either decided or a block that has not yet
 // been verified and added to consensus.
 func (s *State) addBlockOutsideConsensus(blk block.Block) block.Block {
-	wrappedBlk := &BlockWrapper{
-		Block: blk,
-		state: s,
-	}
+	wrappedBlk := s.newBlockWrapper(blk)
 
-	blkID := blk.ID()
-	if blk.Height() <= s.lastAcceptedBlock.Height() {
-		s.decidedBlocks.Put(blkID, wrappedBlk)
+	blkID := s.key(blk)
+	s.lock.RLock()
+	lastAcceptedBlk := s.lastAcceptedBlock
+	s.lock.RUnlock()
+	// Until the last accepted block is known, blocks can't be known to be
+	// decided.
+	if lastAcceptedBlk != nil && blk.Height() <= lastAcceptedBlk.Height() {
+		// A block at or below the last accepted height that isn't accepted
+		// must eventually be rejected.
+		s.decidedBlocks.Put(blkID, decidedBlock{
+			BlockWrapper: wrappedBlk,
+			accepted:     blk.Status() == uint8(choices.Accepted),
+		})
 	} else {
+		if s.metrics != nil {
+			wrappedBlk.live.Store(true)
+			s.metrics.wrapperCreated()
+		}
 		s.unverifiedBlocks.Put(blkID, wrappedBlk)
 	}
 
 	return wrappedBlk
 }
 
+// LastAccepted implements the block.ChainVM interface.
 func (s *State) LastAccepted(context.Context) (ids.ID, error) {
-	return s.lastAcceptedBlock.ID(), nil
+	return s.LastAcceptedID(), nil
+}
+
+// GetBlockIDAtHeight returns the ID of the accepted block at [height]. The
+// most recently accepted heights are served from memory, older heights are
+// looked up with [Config.GetBlockIDAtHeight].
+//
+// Returns [database.ErrNotFound] if there is no known accepted block at
+// [height].
+func (s *State) GetBlockIDAtHeight(ctx context.Context, height uint64) (ids.ID, error) {
+	if blkID, ok := s.acceptedHeights.Get(height); ok {
+		return blkID, nil
+	}
+
+	lastAcceptedBlock := s.LastAcceptedBlock()
+	if s.getBlockIDAtHeight == nil || lastAcceptedBlock == nil || height > lastAcceptedBlock.Height() {
+		return ids.Empty, database.ErrNotFound
+	}
+
+	blkID, err := s.getBlockIDAtHeight(ctx, height)
+	if err != nil {
+		return ids.Empty, err
+	}
+	s.acceptedHeights.Put(height, blkID)
+	return blkID, nil
+}
+
+// LastAcceptedID returns the ID of the last accepted block, or ids.Empty if
+// there is no last accepted block.
+func (s *State) LastAcceptedID() ids.ID {
+	lastAcceptedBlock := s.LastAcceptedBlock()
+	if lastAcceptedBlock == nil {
+		return ids.Empty
+	}
+	return lastAcceptedBlock.ID()
+}
+
+// lastAcceptedKey returns the cache key of the last accepted block, or
+// [ids.Empty] if there is none.
+func (s *State) lastAcceptedKey() ids.ID {
+	lastAcceptedBlock := s.LastAcceptedBlock()
+	if lastAcceptedBlock == nil {
+		return ids.Empty
+	}
+	return lastAcceptedBlock.key()
 }
 
-// LastAcceptedBlock returns the last accepted wrapped block
+// LastAcceptedBlock returns the last accepted wrapped block, or nil if there
+// is no last accepted block.
 func (s *State) LastAcceptedBlock() *BlockWrapper {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
 	return s.lastAcceptedBlock
 }
 
-// LastAcceptedBlockInternal returns the internal block.Block that was last accepted
+// LastAcceptedBlockInternal returns the internal block.Block that was last
+// accepted, or nil if there is no last accepted block.
 func (s *State) LastAcceptedBlockInternal() block.Block {
-	return s.LastAcceptedBlock().Block
+	lastAcceptedBlock := s.LastAcceptedBlock()
+	if lastAcceptedBlock == nil {
+		return nil
+	}
+	return lastAcceptedBlock.Block
 }
 
 // IsProcessing returns whether [blkID] is processing in consensus
 func (s *State) IsProcessing(blkID ids.ID) bool {
-	_, ok := s.verifiedBlocks[blkID]
+	_, ok := s.verifiedBlocks.Get(blkID)
 	return ok
 }
+
+// GetVerified returns the canonical wrapper of [blkID] if the block is
+// processing or is the last accepted block. Unverified blocks, and decided
+// blocks other than the last accepted block, are never returned.
+func (s *State) GetVerified(blkID ids.ID) (*BlockWrapper, bool) {
+	if bw, ok := s.verifiedBlocks.Get(blkID); ok {
+		return bw, true
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.isLastAccepted(blkID) {
+		return s.lastAcceptedBlock, true
+	}
+	return nil, false
+}
+
+// ProcessingBlocks returns a snapshot of the blocks that are currently
+// verified but not yet decided. The order of the returned blocks is
+// unspecified.
+func (s *State) ProcessingBlocks() []block.Block {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blks := make([]block.Block, 0, s.verifiedBlocks.Len())
+	s.verifiedBlocks.Range(func(_ ids.ID, blk *BlockWrapper) bool {
+		blks = append(blks, blk)
+		return true
+	})
+	return blks
+}
+
+// ProcessingBlocksSorted returns the same snapshot as [ProcessingBlocks],
+// sorted by height and then by ID.
+func (s *State) ProcessingBlocksSorted() []block.Block {
+	blks := s.ProcessingBlocks()
+	sortByHeight(blks)
+	return blks
+}
+
+// sortByHeight sorts [blks] by increasing height, breaking ties by ID.
+func sortByHeight(blks []block.Block) {
+	slices.SortFunc(blks, func(a, b block.Block) int {
+		if c := cmp.Compare(a.Height(), b.Height()); c != 0 {
+			return c
+		}
+		return a.ID().Compare(b.ID())
+	})
+}
+
+// OldestProcessingAge returns how long the oldest block that is currently
+// verified but not yet decided has been processing, or zero if no block is
+// processing. A block stops being counted once it is accepted or rejected.
+func (s *State) OldestProcessingAge() time.Duration {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.oldestProcessingAge()
+}
+
+// oldestProcessingAge implements [State.OldestProcessingAge].
+//
+// Assumes [s.lock] is held.
+func (s *State) oldestProcessingAge() time.Duration {
+	var oldest time.Time
+	s.verifiedBlocks.Range(func(_ ids.ID, bw *BlockWrapper) bool {
+		if oldest.IsZero() || bw.verifiedAt.Before(oldest) {
+			oldest = bw.verifiedAt
+		}
+		return true
+	})
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// ProcessingIDs returns a snapshot of the IDs of the blocks that are currently
+// verified but not yet decided, without materializing the blocks. The order of
+// the returned IDs is unspecified.
+func (s *State) ProcessingIDs() []ids.ID {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blkIDs := make([]ids.ID, 0, s.verifiedBlocks.Len())
+	s.verifiedBlocks.Range(func(blkID ids.ID, _ *BlockWrapper) bool {
+		blkIDs = append(blkIDs, blkID)
+		return true
+	})
+	return blkIDs
+}
+
+// ForEachProcessing calls [fn] with every block that is currently verified but
+// not yet decided, in an unspecified order, and evicts the blocks for which
+// [fn] returns true from the verified blocks, such as to drop stale blocks
+// while recovering from a stall. Evicted blocks are no longer processing, so
+// they must also be abandoned by consensus.
+//
+// [fn] is called while the lock of State is held, so it must not call back
+// into State, nor verify or decide the block it is given, as this would
+// deadlock.
+func (s *State) ForEachProcessing(fn func(*BlockWrapper) (evict bool)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var evicted []ids.ID
+	s.verifiedBlocks.Range(func(blkID ids.ID, bw *BlockWrapper) bool {
+		if fn(bw) {
+			evicted = append(evicted, blkID)
+		}
+		return true
+	})
+	for _, blkID := range evicted {
+		s.removeVerified(blkID)
+	}
+}
+
+// decision returns whether [blkID] is known to have been accepted or rejected.
+// Blocks that are processing are never considered decided.
+func (s *State) decision(blkID ids.ID) (accepted bool, decided bool) {
+	s.lock.RLock()
+	_, processing := s.verifiedBlocks.Get(blkID)
+	lastAccepted := s.lastAcceptedBlock != nil && s.lastAcceptedBlock.key() == blkID
+	s.lock.RUnlock()
+
+	switch {
+	case processing:
+		return false, false
+	case lastAccepted:
+		return true, true
+	}
+	blk, ok := s.decidedBlocks.Get(blkID)
+	return blk.accepted, ok
+}
+
+// removeVerified removes [blkID] from the verified blocks and returns the time
+// it spent there, or zero if it wasn't verified.
+//
+// Assumes [s.lock] is held.
+func (s *State) removeVerified(blkID ids.ID) time.Duration {
+	bw, ok := s.verifiedBlocks.Get(blkID)
+	if !ok {
+		return 0
+	}
+	s.verifiedBlocks.Delete(blkID)
+	s.unpinParent(bw)
+	s.metrics.setProcessing(s.verifiedBlocks.Len())
+	return time.Since(bw.verifiedAt)
+}
+
+// isPermanentVerifyError returns true if [err] is one of
+// [Config.PermanentVerifyErrors].
+func (s *State) isPermanentVerifyError(err error) bool {
+	for _, permanentErr := range s.permanentVerifyErrors {
+		if errors.Is(err, permanentErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetryVerify returns true if a verification that failed with [err]
+// after [retries] retries should be retried.
+func (s *State) shouldRetryVerify(err error, retries int) bool {
+	return retries < s.maxVerifyRetries && s.isTemporaryVerifyError != nil && s.isTemporaryVerifyError(err)
+}
+
+// isMissingParentError returns true if [err] is [Config.MissingParentErr] and
+// blocks failing with it should be parked.
+func (s *State) isMissingParentError(err error) bool {
+	return s.pending != nil && errors.Is(err, s.missingParentErr)
+}
+
+// isClosed returns true if [Close] has been called.
+func (s *State) isClosed() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.closed
+}
+
+// tooManyProcessing returns true if no more blocks may be verified. Assumes
+// [s.lock] is held.
+func (s *State) tooManyProcessing() bool {
+	return s.maxProcessing > 0 && s.verifiedBlocks.Len() >= s.maxProcessing
+}
+
+// acquireVerifySlot waits until an underlying block may be verified, as
+// limited by [Config.MaxConcurrentVerify], or until [ctx] is cancelled.
+func (s *State) acquireVerifySlot(ctx context.Context) error {
+	if s.verifySlots == nil {
+		return nil
+	}
+	return s.verifySlots.Acquire(ctx, 1)
+}
+
+// releaseVerifySlot releases the slot taken by [acquireVerifySlot].
+func (s *State) releaseVerifySlot() {
+	if s.verifySlots != nil {
+		s.verifySlots.Release(1)
+	}
+}
+
+// checkHeight returns an error if [Config.CheckHeightContinuity] is set, the
+// parent of [bw] is cached and [bw] isn't at the height following its parent.
+func (s *State) checkHeight(bw *BlockWrapper) error {
+	if !s.checkHeightContinuity || bw.Height() == 0 {
+		return nil
+	}
+	parent, ok := s.getCachedBlock(bw.Parent())
+	if !ok {
+		return nil
+	}
+	if expected := parent.Height() + 1; bw.Height() != expected {
+		return fmt.Errorf("%w: block %s at height %d has parent %s at height %d",
+			errHeightDiscontinuity,
+			bw.ID(),
+			bw.Height(),
+			parent.ID(),
+			parent.Height(),
+		)
+	}
+	return nil
+}
+
+// missingParent returns true if [blk] may not be verified because
+// [Config.StrictParents] is set and its parent is neither the last accepted
+// block nor processing. Assumes [s.lock] is held.
+func (s *State) missingParent(blk block.Block) bool {
+	if !s.strictParents {
+		return false
+	}
+	parentID := blk.Parent()
+	if s.lastAcceptedBlock != nil && s.lastAcceptedBlock.key() == parentID {
+		return false
+	}
+	_, ok := s.verifiedBlocks.Get(parentID)
+	return !ok
+}
+
+// evictDescendants removes all the descendants of [blkID] from
+// [verifiedBlocks].
+//
+// Assumes [s.lock] is held.
+func (s *State) evictDescendants(blkID ids.ID) {
+	children := make(map[ids.ID][]ids.ID)
+	s.verifiedBlocks.Range(func(childID ids.ID, child *BlockWrapper) bool {
+		parentID := child.Parent()
+		children[parentID] = append(children[parentID], childID)
+		return true
+	})
+
+	toEvict := children[blkID]
+	for len(toEvict) > 0 {
+		childID := toEvict[len(toEvict)-1]
+		toEvict = toEvict[:len(toEvict)-1]
+
+		s.removeVerified(childID)
+		toEvict = append(toEvict, children[childID]...)
+	}
+}
+
+// evictOrphans removes the blocks that don't descend from the last accepted
+// block from [verifiedBlocks], if [Config.AutoOrphanCleanup] is set and at
+// most [MaxOrphanScan] blocks are processing.
+//
+// Assumes [s.lock] is held.
+func (s *State) evictOrphans() {
+	numProcessing := s.verifiedBlocks.Len()
+	if !s.autoOrphanCleanup || numProcessing == 0 || numProcessing > MaxOrphanScan {
+		return
+	}
+
+	children := make(map[ids.ID][]ids.ID)
+	s.verifiedBlocks.Range(func(childID ids.ID, child *BlockWrapper) bool {
+		parentID := child.Parent()
+		children[parentID] = append(children[parentID], childID)
+		return true
+	})
+
+	// Mark the descendants of the last accepted block, which are the only
+	// blocks that can still be accepted.
+	descendants := make(map[ids.ID]struct{}, numProcessing)
+	toVisit := children[s.lastAcceptedBlock.key()]
+	for len(toVisit) > 0 {
+		blkID := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+
+		descendants[blkID] = struct{}{}
+		toVisit = append(toVisit, children[blkID]...)
+	}
+	if len(descendants) == numProcessing {
+		return
+	}
+
+	var orphans []ids.ID
+	s.verifiedBlocks.Range(func(blkID ids.ID, _ *BlockWrapper) bool {
+		if _, ok := descendants[blkID]; !ok {
+			orphans = append(orphans, blkID)
+		}
+		return true
+	})
+	for _, blkID := range orphans {
+		s.removeVerified(blkID)
+	}
+}
@@ -0,0 +1,1212 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/metric"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+const testCacheSize = 1024 * 1024
+
+func newTestConfig(genesis *chaintest.Block, blks chaintest.Blocks) *Config {
+	blks[genesis.ID()] = genesis
+	return &Config{
+		DecidedCacheSize:    testCacheSize,
+		MissingCacheSize:    testCacheSize,
+		UnverifiedCacheSize: testCacheSize,
+		BytesToIDCacheSize:  testCacheSize,
+		LastAcceptedBlock:   genesis,
+		GetBlock:            blks.GetBlock,
+		UnmarshalBlock:      blks.ParseBlock,
+	}
+}
+
+func TestConcurrentVerifySiblings(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blks := chaintest.Blocks{}
+	state, err := NewMeteredState(metric.NewRegistry(), newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	const numSiblings = 32
+	wrappers := make([]*BlockWrapper, numSiblings)
+	for i := range wrappers {
+		sibling := chaintest.NewBlock(genesis)
+		blks[sibling.ID()] = sibling
+		blk, err := state.ParseBlock(context.Background(), sibling.Bytes())
+		require.NoError(err)
+		wrappers[i] = blk.(*BlockWrapper)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, numSiblings)
+	)
+	for i, bw := range wrappers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = bw.Verify(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	for i, bw := range wrappers {
+		require.NoError(errs[i])
+		require.True(state.IsProcessing(bw.ID()))
+	}
+}
+
+func TestGetBlockCachesLoadedBlocks(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{
+		child.ID(): child,
+	}
+	state, err := NewState(newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	// The first lookup falls through to the VM and caches the child as
+	// unverified since it is above the last accepted height.
+	blk, err := state.GetBlock(context.Background(), child.ID())
+	require.NoError(err)
+	cachedBlk, ok := state.unverifiedBlocks.Get(child.ID())
+	require.True(ok)
+	require.Same(blk, cachedBlk)
+
+	// Subsequent lookups are served from the cache, even if the VM no longer
+	// knows about the block.
+	delete(blks, child.ID())
+	blk2, err := state.GetBlock(context.Background(), child.ID())
+	require.NoError(err)
+	require.Same(blk, blk2)
+
+	// Once verified, the same wrapper is served from verifiedBlocks.
+	require.NoError(blk.Verify(context.Background()))
+	_, ok = state.unverifiedBlocks.Get(child.ID())
+	require.False(ok)
+	blk3, err := state.GetBlock(context.Background(), child.ID())
+	require.NoError(err)
+	require.Same(blk, blk3)
+
+	// Unknown blocks are remembered as missing.
+	missingID := ids.GenerateTestID()
+	_, err = state.GetBlock(context.Background(), missingID)
+	require.ErrorIs(err, database.ErrNotFound)
+	_, ok = state.missingBlocks.Get(missingID)
+	require.True(ok)
+}
+
+func TestLastAcceptedAdvancesOnAccept(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+
+	require.Equal(child.ID(), state.LastAcceptedID())
+	lastAcceptedID, err := state.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(child.ID(), lastAcceptedID)
+	require.Same(blk, state.LastAcceptedBlock())
+	require.Equal(child, state.LastAcceptedBlockInternal())
+}
+
+func TestLastAcceptedIDWithoutLastAcceptedBlock(t *testing.T) {
+	state := &State{}
+	require.Equal(t, ids.Empty, state.LastAcceptedID())
+	require.Nil(t, state.LastAcceptedBlockInternal())
+}
+
+func TestInitialize(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	})
+	config.LastAcceptedBlock = nil
+	state, err := NewState(config)
+	require.NoError(err)
+	require.Equal(ids.Empty, state.LastAcceptedID())
+
+	// Blocks wrapped before the last accepted block is known aren't
+	// considered decided.
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.Equal(CacheLocationUnverified, blk.(*BlockWrapper).CacheLocation())
+
+	require.NoError(state.Initialize(ctx, genesis))
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+	genesisBlk, err := state.GetBlock(ctx, genesis.ID())
+	require.NoError(err)
+	require.Same(state.LastAcceptedBlock(), genesisBlk)
+	genesisID, err := state.GetBlockIDAtHeight(ctx, genesis.Height())
+	require.NoError(err)
+	require.Equal(genesis.ID(), genesisID)
+
+	err = state.Initialize(ctx, child)
+	require.ErrorIs(err, errAlreadyInitialized)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+
+	// A State created with the last accepted block is already initialized.
+	state, err = NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	err = state.Initialize(ctx, genesis)
+	require.ErrorIs(err, errAlreadyInitialized)
+}
+
+func TestAcceptBeforeInitialize(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	})
+	config.LastAcceptedBlock = nil
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+	require.Zero(state.PruneDecidedBelow(0))
+
+	err = state.Initialize(ctx, genesis)
+	require.ErrorIs(err, errAlreadyInitialized)
+}
+
+func TestWrapBlockReturnsCanonicalWrapper(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	bw := state.WrapBlock(child)
+	require.Equal(child, bw.Block)
+	require.Same(bw, state.WrapBlock(child))
+	require.Same(bw, state.WrapBlock(bw))
+	require.Same(state.LastAcceptedBlock(), state.WrapBlock(genesis))
+
+	// The wrapper is attached to the state.
+	require.NoError(bw.Verify(context.Background()))
+	require.True(state.IsProcessing(child.ID()))
+}
+
+// countingVerifyBlock is a block that counts the calls to Verify.
+type countingVerifyBlock struct {
+	*chaintest.Block
+
+	verifyCalls int
+}
+
+func (b *countingVerifyBlock) Verify(ctx context.Context) error {
+	b.verifyCalls++
+	return b.Block.Verify(ctx)
+}
+
+func TestVerifyDuplicateWrappers(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	// Two byte-identical copies of a block are wrapped separately, as if
+	// they were received from different peers and the first wrapper was
+	// evicted from the unverified cache in between.
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	original := &countingVerifyBlock{Block: child}
+	duplicate := &countingVerifyBlock{Block: child}
+	bw := state.WrapBlock(original)
+	state.Flush()
+	duplicateBw := state.WrapBlock(duplicate)
+	require.NotSame(bw, duplicateBw)
+
+	require.NoError(bw.Verify(ctx))
+	require.NoError(duplicateBw.Verify(ctx))
+	require.Equal(1, original.verifyCalls)
+	require.Zero(duplicate.verifyCalls)
+
+	// Consensus and the cache agree on the first verified wrapper.
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.Same(bw, blk)
+	require.Equal([]block.Block{bw}, state.ProcessingBlocks())
+	require.Equal(CacheLocationVerified, bw.CacheLocation())
+	require.Equal(CacheLocationNone, duplicateBw.CacheLocation())
+}
+
+func TestConflictingBytes(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	// conflicting has the ID of [child], but different bytes.
+	conflicting := *child
+	conflicting.BytesV = []byte("conflicting")
+	config := newTestConfig(genesis, chaintest.Blocks{child.ID(): child})
+	unmarshalBlock := config.UnmarshalBlock
+	config.UnmarshalBlock = func(ctx context.Context, b []byte) (block.Block, error) {
+		if bytes.Equal(b, conflicting.BytesV) {
+			return &conflicting, nil
+		}
+		return unmarshalBlock(ctx, b)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	bw, err := state.ParseBlock(ctx, child.Bytes())
+	require.NoError(err)
+	_, err = state.ParseBlock(ctx, conflicting.BytesV)
+	require.ErrorIs(err, errConflictingBytes)
+	_, err = state.BatchedParseBlock(ctx, [][]byte{conflicting.BytesV})
+	require.ErrorIs(err, errConflictingBytes)
+
+	// A duplicate wrapper with different bytes isn't merged into the
+	// verified wrapper.
+	state.Flush()
+	conflictingBw := state.WrapBlock(&conflicting)
+	require.NotSame(bw, conflictingBw)
+	require.NoError(bw.Verify(ctx))
+	require.ErrorIs(conflictingBw.Verify(ctx), errConflictingBytes)
+	require.Len(state.ProcessingIDs(), 1)
+}
+
+func TestVerifyDuplicateWrappersConcurrently(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	blocking := &blockingVerifyBlock{
+		Block:     child,
+		verifying: make(chan struct{}),
+		unblock:   make(chan struct{}),
+	}
+	blockingBw := state.WrapBlock(blocking)
+	state.Flush()
+	bw := state.WrapBlock(child)
+	require.NotSame(blockingBw, bw)
+
+	errs := make(chan error)
+	go func() {
+		errs <- blockingBw.Verify(ctx)
+	}()
+	<-blocking.verifying
+
+	// The wrapper verified first is kept once the other one finishes.
+	require.NoError(bw.Verify(ctx))
+	close(blocking.unblock)
+	require.NoError(<-errs)
+	require.Equal([]block.Block{bw}, state.ProcessingBlocks())
+}
+
+func TestVerifyAndGet(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	bw, err := state.VerifyAndGet(ctx, child)
+	require.NoError(err)
+	require.Equal(child, bw.Block)
+	require.True(state.IsProcessing(child.ID()))
+
+	// A duplicate returns the wrapper that was verified first.
+	state.Flush()
+	duplicate, err := state.VerifyAndGet(ctx, &countingVerifyBlock{Block: child})
+	require.NoError(err)
+	require.Same(bw, duplicate)
+
+	invalid := chaintest.NewBlock(genesis)
+	invalid.VerifyV = errTestVerify
+	_, err = state.VerifyAndGet(ctx, invalid)
+	require.ErrorIs(err, errTestVerify)
+	require.False(state.IsProcessing(invalid.ID()))
+}
+
+// blockingVerifyBlock is a block whose Verify blocks until [unblock] is
+// closed.
+type blockingVerifyBlock struct {
+	*chaintest.Block
+
+	verifying chan struct{}
+	unblock   chan struct{}
+}
+
+func (b *blockingVerifyBlock) Verify(ctx context.Context) error {
+	close(b.verifying)
+	<-b.unblock
+	return b.Block.Verify(ctx)
+}
+
+func TestClose(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	processing := chaintest.NewBlock(genesis)
+	inFlight := &blockingVerifyBlock{
+		Block:     chaintest.NewBlock(genesis),
+		verifying: make(chan struct{}),
+		unblock:   make(chan struct{}),
+	}
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	processingBlk := state.WrapBlock(processing)
+	require.NoError(processingBlk.Verify(ctx))
+
+	inFlightBlk := state.WrapBlock(inFlight)
+	inFlightErr := make(chan error, 1)
+	go func() {
+		inFlightErr <- inFlightBlk.Verify(ctx)
+	}()
+	<-inFlight.verifying
+
+	require.NoError(state.Close())
+	require.False(state.IsProcessing(processing.ID()))
+	_, ok := state.Status(processing.ID())
+	require.False(ok)
+
+	// The in-flight verification completes, but its block isn't cached.
+	close(inFlight.unblock)
+	require.ErrorIs(<-inFlightErr, ErrClosed)
+	require.False(state.IsProcessing(inFlight.ID()))
+
+	// New operations are rejected.
+	require.ErrorIs(processingBlk.Verify(ctx), ErrClosed)
+	require.ErrorIs(processingBlk.Accept(ctx), ErrClosed)
+	require.ErrorIs(processingBlk.Reject(ctx), ErrClosed)
+	require.Equal(genesis.ID(), state.LastAcceptedID())
+}
+
+func TestProcessingBlocks(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	require.Empty(state.ProcessingBlocks())
+
+	ctx := context.Background()
+	blk1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	blk2 := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk1.Verify(ctx))
+	require.NoError(blk2.Verify(ctx))
+
+	processing := state.ProcessingBlocks()
+	require.ElementsMatch([]block.Block{blk1, blk2}, processing)
+
+	// Mutating the snapshot doesn't affect the state.
+	processing[0] = nil
+	require.ElementsMatch([]block.Block{blk1, blk2}, state.ProcessingBlocks())
+
+	require.NoError(blk1.Accept(ctx))
+	require.Equal([]block.Block{blk2}, state.ProcessingBlocks())
+}
+
+func TestProcessingBlocksSorted(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	require.Empty(state.ProcessingBlocksSorted())
+
+	ctx := context.Background()
+	var expected []block.Block
+	for _, blkID := range []ids.ID{{3}, {1}, {2}} {
+		blk := chaintest.NewBlock(genesis)
+		blk.IDV = blkID
+		child := chaintest.NewBlock(blk)
+		bw := state.WrapBlock(blk)
+		childBw := state.WrapBlock(child)
+		require.NoError(bw.Verify(ctx))
+		require.NoError(childBw.Verify(ctx))
+		expected = append(expected, bw, childBw)
+	}
+	slices.SortFunc(expected, func(a, b block.Block) int {
+		if a.Height() != b.Height() {
+			return int(a.Height()) - int(b.Height())
+		}
+		return a.ID().Compare(b.ID())
+	})
+
+	sorted := state.ProcessingBlocksSorted()
+	require.Equal(expected, sorted)
+	require.Equal(ids.ID{1}, sorted[0].ID())
+	require.Equal(ids.ID{2}, sorted[1].ID())
+	require.Equal(ids.ID{3}, sorted[2].ID())
+	for _, blk := range sorted[3:] {
+		require.Equal(uint64(2), blk.Height())
+	}
+}
+
+func TestOldestProcessingAge(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	require.Zero(state.OldestProcessingAge())
+
+	ctx := context.Background()
+	oldest := state.WrapBlock(chaintest.NewBlock(genesis))
+	newest := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(oldest.Verify(ctx))
+	require.NoError(newest.Verify(ctx))
+	state.lock.Lock()
+	oldest.verifiedAt = time.Now().Add(-time.Hour)
+	newest.verifiedAt = time.Now().Add(-time.Minute)
+	state.lock.Unlock()
+	require.GreaterOrEqual(state.OldestProcessingAge(), time.Hour)
+
+	// Decided blocks are no longer counted.
+	require.NoError(oldest.Reject(ctx))
+	age := state.OldestProcessingAge()
+	require.GreaterOrEqual(age, time.Minute)
+	require.Less(age, time.Hour)
+
+	require.NoError(newest.Accept(ctx))
+	require.Zero(state.OldestProcessingAge())
+}
+
+func TestProcessingIDs(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+	require.Empty(state.ProcessingIDs())
+
+	ctx := context.Background()
+	blk1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	blk2 := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(blk1.Verify(ctx))
+	require.NoError(blk2.Verify(ctx))
+	require.ElementsMatch([]ids.ID{blk1.ID(), blk2.ID()}, state.ProcessingIDs())
+
+	require.NoError(blk2.Reject(ctx))
+	require.Equal([]ids.ID{blk1.ID()}, state.ProcessingIDs())
+}
+
+func TestGetBlockIDAtHeight(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	grandchild := chaintest.NewBlock(child)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.HeightIndexCacheSize = 1
+
+	var fallbackHeights []uint64
+	config.GetBlockIDAtHeight = func(_ context.Context, height uint64) (ids.ID, error) {
+		fallbackHeights = append(fallbackHeights, height)
+		switch height {
+		case genesis.HeightV:
+			return genesis.ID(), nil
+		case child.HeightV:
+			return child.ID(), nil
+		default:
+			return ids.Empty, database.ErrNotFound
+		}
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	blkID, err := state.GetBlockIDAtHeight(ctx, genesis.HeightV)
+	require.NoError(err)
+	require.Equal(genesis.ID(), blkID)
+	require.Empty(fallbackHeights)
+
+	for _, blk := range []*chaintest.Block{child, grandchild} {
+		bw := state.WrapBlock(blk)
+		require.NoError(bw.Verify(ctx))
+		require.NoError(bw.Accept(ctx))
+	}
+
+	// The most recent height is indexed in memory.
+	blkID, err = state.GetBlockIDAtHeight(ctx, grandchild.HeightV)
+	require.NoError(err)
+	require.Equal(grandchild.ID(), blkID)
+	require.Empty(fallbackHeights)
+
+	// Older heights fall back to the loader.
+	blkID, err = state.GetBlockIDAtHeight(ctx, genesis.HeightV)
+	require.NoError(err)
+	require.Equal(genesis.ID(), blkID)
+	require.Equal([]uint64{genesis.HeightV}, fallbackHeights)
+
+	// Heights above the last accepted block have not been accepted yet.
+	_, err = state.GetBlockIDAtHeight(ctx, grandchild.HeightV+1)
+	require.ErrorIs(err, database.ErrNotFound)
+	require.Equal([]uint64{genesis.HeightV}, fallbackHeights)
+}
+
+func TestGetBlockIDAtHeightWithoutFallback(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.HeightIndexCacheSize = 1
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	bw := state.WrapBlock(child)
+	require.NoError(bw.Verify(ctx))
+	require.NoError(bw.Accept(ctx))
+
+	_, err = state.GetBlockIDAtHeight(ctx, genesis.HeightV)
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestOnEvict(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blks := chaintest.Blocks{}
+	config := newTestConfig(genesis, blks)
+	var (
+		state   *State
+		evicted []ids.ID
+	)
+	config.UnverifiedCacheSize = 2 * cachedBlockSize(ids.Empty, &BlockWrapper{Block: chaintest.NewBlock(genesis)})
+	config.OnEvict = func(blkID ids.ID, blk block.Block) {
+		// The callback may call back into the state without deadlocking.
+		require.False(state.IsProcessing(blkID))
+		require.IsType(&chaintest.Block{}, blk)
+		evicted = append(evicted, blkID)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	unverified := make([]*BlockWrapper, 3)
+	for i := range unverified {
+		unverified[i] = state.WrapBlock(chaintest.NewBlock(genesis))
+	}
+	require.Equal([]ids.ID{unverified[0].ID()}, evicted)
+
+	// Verifying a block moves it out of the unverified cache without
+	// evicting it.
+	require.NoError(unverified[1].Verify(ctx))
+	require.NoError(unverified[1].Accept(ctx))
+	require.Equal([]ids.ID{unverified[0].ID()}, evicted)
+}
+
+func TestRehydrate(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.TrustedRehydrate = true
+	state, err := NewState(config)
+	require.NoError(err)
+
+	// The underlying block is not verified again.
+	ctx := context.Background()
+	processing := chaintest.NewBlock(genesis)
+	processing.VerifyV = errTestVerify
+	bw, err := state.Rehydrate(ctx, processing)
+	require.NoError(err)
+	require.True(state.IsProcessing(processing.ID()))
+	require.Same(bw, state.WrapBlock(processing))
+	require.NoError(bw.Verify(ctx))
+
+	// Decided blocks are never overwritten.
+	accepted := state.WrapBlock(chaintest.NewBlock(processing))
+	require.NoError(bw.Accept(ctx))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	for _, blk := range []block.Block{genesis, processing, accepted.Block} {
+		_, err = state.Rehydrate(ctx, blk)
+		require.ErrorIs(err, errBlockAlreadyDecided)
+		require.False(state.IsProcessing(blk.ID()))
+		status, _ := state.Status(blk.ID())
+		require.Equal(StatusAccepted, status)
+	}
+}
+
+func TestRehydrateNotTrusted(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	blk := chaintest.NewBlock(genesis)
+	_, err = state.Rehydrate(context.Background(), blk)
+	require.ErrorIs(err, errRehydrateNotTrusted)
+	require.False(state.IsProcessing(blk.ID()))
+}
+
+func TestVerifyDryRun(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	refused := chaintest.NewBlock(genesis)
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.PreVerify = func(_ context.Context, blk block.Block) error {
+		if blk.ID() == refused.ID() {
+			return errTestVerify
+		}
+		return nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	require.NoError(state.VerifyDryRun(ctx, child))
+	_, ok := state.Status(child.ID())
+	require.False(ok)
+
+	// Unverified wrappers stay unverified.
+	bw := state.WrapBlock(child)
+	require.NoError(state.VerifyDryRun(ctx, bw))
+	status, _ := state.Status(child.ID())
+	require.Equal(StatusUnverified, status)
+
+	require.ErrorIs(state.VerifyDryRun(ctx, refused), errTestVerify)
+
+	child.VerifyV = errTestVerify
+	require.ErrorIs(state.VerifyDryRun(ctx, bw), errTestVerify)
+}
+
+func TestUnverifiedTTL(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.UnverifiedTTL = time.Hour
+	state, err := NewState(config)
+	require.NoError(err)
+
+	clock := &testClock{time: time.Unix(0, 0)}
+	state.unverifiedLRU.lock.Lock()
+	state.unverifiedLRU.now = clock.now
+	state.unverifiedLRU.lock.Unlock()
+
+	stale := state.WrapBlock(chaintest.NewBlock(genesis))
+	clock.time = clock.time.Add(45 * time.Minute)
+	fresh := state.WrapBlock(chaintest.NewBlock(genesis))
+	swept := state.WrapBlock(chaintest.NewBlock(genesis))
+
+	// Stale blocks are evicted when they are looked up.
+	clock.time = clock.time.Add(30 * time.Minute)
+	_, ok := state.Status(stale.ID())
+	require.False(ok)
+	status, ok := state.Status(fresh.ID())
+	require.True(ok)
+	require.Equal(StatusUnverified, status)
+
+	// And by the sweep, without being looked up.
+	clock.time = clock.time.Add(time.Hour)
+	state.unverifiedLRU.expire()
+	require.Zero(state.unverifiedLRU.Len())
+	_, ok = state.Status(swept.ID())
+	require.False(ok)
+
+	require.NoError(state.Close())
+	require.NoError(state.Close())
+}
+
+func TestPruneDecidedBelow(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blks := []*BlockWrapper{state.lastAcceptedBlock}
+	for range 3 {
+		parent := blks[len(blks)-1].Block.(*chaintest.Block)
+		blk := state.WrapBlock(chaintest.NewBlock(parent))
+		require.NoError(blk.Verify(ctx))
+		blks = append(blks, blk)
+	}
+	rejected := state.WrapBlock(chaintest.NewBlock(blks[1].Block.(*chaintest.Block)))
+	require.NoError(rejected.Verify(ctx))
+	for _, blk := range blks[1:] {
+		require.NoError(blk.Accept(ctx))
+	}
+	require.NoError(rejected.Reject(ctx))
+
+	require.Equal(4, state.PruneDecidedBelow(blks[2].Height()+1))
+	for _, blk := range []*BlockWrapper{blks[0], blks[1], blks[2], rejected} {
+		_, ok := state.Status(blk.ID())
+		require.False(ok)
+	}
+	status, _ := state.Status(blks[3].ID())
+	require.Equal(StatusAccepted, status)
+
+	// The last accepted block is retained.
+	require.Zero(state.PruneDecidedBelow(blks[3].Height() + 1))
+	require.Equal(blks[3].ID(), state.LastAcceptedID())
+	status, _ = state.Status(blks[3].ID())
+	require.Equal(StatusAccepted, status)
+}
+
+func TestGetVerified(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	verified := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(verified.Verify(ctx))
+	unverified := state.WrapBlock(chaintest.NewBlock(genesis))
+
+	bw, ok := state.GetVerified(verified.ID())
+	require.True(ok)
+	require.Same(verified, bw)
+
+	bw, ok = state.GetVerified(genesis.ID())
+	require.True(ok)
+	require.Same(state.LastAcceptedBlock(), bw)
+
+	_, ok = state.GetVerified(unverified.ID())
+	require.False(ok)
+	_, ok = state.GetVerified(ids.GenerateTestID())
+	require.False(ok)
+
+	// Once accepted, the block is the last accepted block, while the previous
+	// last accepted block is no longer returned.
+	require.NoError(verified.Accept(ctx))
+	bw, ok = state.GetVerified(verified.ID())
+	require.True(ok)
+	require.Same(verified, bw)
+	_, ok = state.GetVerified(genesis.ID())
+	require.False(ok)
+}
+
+func TestForEachProcessing(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	parent := state.WrapBlock(chaintest.NewBlock(genesis))
+	child := state.WrapBlock(chaintest.NewBlock(parent.Block.(*chaintest.Block)))
+	sibling := state.WrapBlock(chaintest.NewBlock(genesis))
+	for _, blk := range []*BlockWrapper{parent, child, sibling} {
+		require.NoError(blk.Verify(ctx))
+	}
+
+	visited := make(map[ids.ID]struct{})
+	state.ForEachProcessing(func(bw *BlockWrapper) bool {
+		visited[bw.ID()] = struct{}{}
+		return bw.Height() > 1 || bw.ID() == sibling.ID()
+	})
+	require.Len(visited, 3)
+	require.Equal([]ids.ID{parent.ID()}, state.ProcessingIDs())
+
+	// Evicted blocks may be verified again.
+	require.NoError(child.Verify(ctx))
+	require.True(state.IsProcessing(child.ID()))
+
+	// Nothing is evicted if the callback returns false.
+	state.ForEachProcessing(func(*BlockWrapper) bool {
+		return false
+	})
+	require.Len(state.ProcessingIDs(), 2)
+}
+
+func TestDisableDecidedCache(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	blks := chaintest.Blocks{}
+	config := newTestConfig(genesis, blks)
+	config.DisableDecidedCache = true
+	state, err := NewMeteredState(metric.NewRegistry(), config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+
+	// The last accepted block is still tracked.
+	require.Equal(accepted.ID(), state.LastAcceptedID())
+	status, _ := state.Status(accepted.ID())
+	require.Equal(StatusAccepted, status)
+	got, err := state.GetBlock(ctx, accepted.ID())
+	require.NoError(err)
+	require.Same(accepted, got)
+
+	// Other decided blocks aren't cached.
+	require.Zero(state.decidedBlocks.Len())
+	_, ok := state.Status(genesis.ID())
+	require.False(ok)
+	_, ok = state.Status(rejected.ID())
+	require.False(ok)
+	require.Empty(state.DecidedInRange(0, 1))
+
+	// The last accepted block is still known to be decided, so it doesn't
+	// become processing again.
+	require.ErrorIs(accepted.Verify(ctx), errBlockAlreadyDecided)
+	require.False(state.IsProcessing(accepted.ID()))
+
+	// Children of the last accepted block can still be verified and
+	// accepted.
+	child := state.WrapBlock(chaintest.NewBlock(accepted.Block.(*chaintest.Block)))
+	require.NoError(child.Verify(ctx))
+	require.NoError(child.Accept(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+}
+
+func TestDisableRejectedCache(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.DisableRejectedCache = true
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	accepted := state.WrapBlock(chaintest.NewBlock(genesis))
+	rejected := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(rejected.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	require.NoError(rejected.Reject(ctx))
+
+	// The accepted block is cached, but the rejected block isn't.
+	_, ok := state.decidedBlocks.Get(accepted.ID())
+	require.True(ok)
+	_, ok = state.decidedBlocks.Get(rejected.ID())
+	require.False(ok)
+	_, ok = state.Status(rejected.ID())
+	require.False(ok)
+}
+
+func TestDecidedInRange(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	blks := []*BlockWrapper{state.lastAcceptedBlock}
+	for range 4 {
+		parent := blks[len(blks)-1].Block.(*chaintest.Block)
+		blk := state.WrapBlock(chaintest.NewBlock(parent))
+		require.NoError(blk.Verify(ctx))
+		blks = append(blks, blk)
+	}
+	rejected := state.WrapBlock(chaintest.NewBlock(blks[1].Block.(*chaintest.Block)))
+	require.NoError(rejected.Verify(ctx))
+	for _, blk := range blks[1:4] {
+		require.NoError(blk.Accept(ctx))
+	}
+	require.NoError(rejected.Reject(ctx))
+
+	blkIDs := func(blks []block.Block) []ids.ID {
+		blkIDs := make([]ids.ID, len(blks))
+		for i, blk := range blks {
+			blkIDs[i] = blk.ID()
+		}
+		return blkIDs
+	}
+
+	// blks[4] is still processing, so it isn't returned.
+	got := state.DecidedInRange(1, 4)
+	require.Len(got, 4)
+	for i := 1; i < len(got); i++ {
+		require.LessOrEqual(got[i-1].Height(), got[i].Height())
+	}
+	require.ElementsMatch(
+		[]ids.ID{blks[1].ID(), blks[2].ID(), blks[3].ID(), rejected.ID()},
+		blkIDs(got),
+	)
+
+	require.Equal([]ids.ID{blks[0].ID(), blks[1].ID()}, blkIDs(state.DecidedInRange(0, 1)))
+	require.Empty(state.DecidedInRange(2, 1))
+
+	// Evicted blocks are omitted.
+	require.Equal(4, state.PruneDecidedBelow(3))
+	require.Equal([]ids.ID{blks[3].ID()}, blkIDs(state.DecidedInRange(0, 3)))
+}
+
+func TestMissingBlocksForgottenOnceDecided(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	// The block is unknown to the VM when it is first requested.
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	_, err = state.GetBlock(ctx, child.ID())
+	require.ErrorIs(err, database.ErrNotFound)
+	_, ok := state.missingBlocks.Get(child.ID())
+	require.True(ok)
+
+	blk := &BlockWrapper{Block: child, state: state}
+	require.NoError(blk.Verify(ctx))
+	_, ok = state.missingBlocks.Get(child.ID())
+	require.False(ok)
+
+	state.missingBlocks.Put(child.ID(), struct{}{})
+	require.NoError(blk.Accept(ctx))
+	_, ok = state.missingBlocks.Get(child.ID())
+	require.False(ok)
+}
+
+func TestKeyFunc(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.KeyFunc = func(blk block.Block) ids.ID {
+		return blk.ID().Prefix(1)
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	blk := state.WrapBlock(child)
+	key := child.ID().Prefix(1)
+	_, ok := state.unverifiedBlocks.Get(key)
+	require.True(ok)
+	_, ok = state.unverifiedBlocks.Get(child.ID())
+	require.False(ok)
+
+	require.NoError(blk.Verify(ctx))
+	require.True(state.IsProcessing(key))
+	require.NoError(blk.Accept(ctx))
+	status, ok := state.Status(key)
+	require.True(ok)
+	require.Equal(StatusAccepted, status)
+	require.Equal(child.ID(), state.LastAcceptedID())
+}
+
+func TestTrim(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	genesisBlk := state.lastAcceptedBlock
+	a1 := state.WrapBlock(chaintest.NewBlock(genesis))
+	a2 := state.WrapBlock(chaintest.NewBlock(a1.Block.(*chaintest.Block)))
+	processing := state.WrapBlock(chaintest.NewBlock(a2.Block.(*chaintest.Block)))
+	for _, blk := range []*BlockWrapper{a1, a2, processing} {
+		require.NoError(blk.Verify(ctx))
+	}
+	require.NoError(a1.Accept(ctx))
+	require.NoError(a2.Accept(ctx))
+	unverified := []*BlockWrapper{
+		state.WrapBlock(chaintest.NewBlock(a2.Block.(*chaintest.Block))),
+		state.WrapBlock(chaintest.NewBlock(a2.Block.(*chaintest.Block))),
+	}
+
+	// Every cached block has the same estimated size.
+	size := int64(cachedBlockSize(a1.ID(), a1))
+	require.Zero(state.Trim(5 * size))
+
+	// The least recently used decided block is evicted first.
+	require.Equal(1, state.Trim(4*size))
+	require.Equal(CacheLocationNone, genesisBlk.CacheLocation())
+
+	require.Equal(2, state.Trim(2*size))
+	require.Equal(CacheLocationNone, a1.CacheLocation())
+	require.Equal(CacheLocationNone, unverified[0].CacheLocation())
+	require.Equal(CacheLocationUnverified, unverified[1].CacheLocation())
+
+	// The last accepted and verified blocks are never evicted.
+	require.Equal(1, state.Trim(0))
+	require.Equal(CacheLocationDecided, a2.CacheLocation())
+	require.Equal(CacheLocationVerified, processing.CacheLocation())
+	require.Zero(state.Trim(0))
+}
+
+func TestTrimPinned(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	genesisBlk := state.lastAcceptedBlock
+	parentBlk := chaintest.NewBlock(genesis)
+	parent := state.WrapBlock(parentBlk)
+	require.NoError(parent.Verify(ctx))
+	require.NoError(parent.Accept(ctx))
+
+	accepted := state.WrapBlock(chaintest.NewBlock(parentBlk))
+	processing := state.WrapBlock(chaintest.NewBlock(parentBlk))
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(processing.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+
+	// [parent] is pinned by [processing], so only the genesis block is
+	// evicted and [parent] remains part of the footprint.
+	size := int64(cachedBlockSize(parent.ID(), parent))
+	require.Equal(3*size, state.footprint())
+	require.Equal(1, state.Trim(0))
+	require.Equal(2*size, state.footprint())
+	require.Equal(CacheLocationNone, genesisBlk.CacheLocation())
+	require.Equal(CacheLocationDecided, parent.CacheLocation())
+	require.Equal(CacheLocationDecided, accepted.CacheLocation())
+	require.Zero(state.Trim(0))
+}
+
+func TestEvict(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	acceptedBlk := chaintest.NewBlock(genesis)
+	accepted := state.WrapBlock(acceptedBlk)
+	require.NoError(accepted.Verify(ctx))
+	require.NoError(accepted.Accept(ctx))
+	verified := state.WrapBlock(chaintest.NewBlock(acceptedBlk))
+	require.NoError(verified.Verify(ctx))
+	unverified := state.WrapBlock(chaintest.NewBlock(acceptedBlk))
+
+	// The last accepted block is refused.
+	err = state.Evict(accepted.ID())
+	require.ErrorIs(err, errEvictLastAccepted)
+	require.Equal(CacheLocationDecided, accepted.CacheLocation())
+
+	for _, blkID := range []ids.ID{genesis.ID(), verified.ID(), unverified.ID()} {
+		require.NoError(state.Evict(blkID))
+		_, ok := state.Status(blkID)
+		require.False(ok)
+	}
+	// Only genesis is known to the VM, so the other blocks are gone.
+	_, err = state.GetBlock(ctx, verified.ID())
+	require.ErrorIs(err, database.ErrNotFound)
+	require.Empty(state.ProcessingIDs())
+	require.Zero(state.decidedBlocks.numPinned())
+
+	// Unknown blocks are ignored.
+	require.NoError(state.Evict(ids.GenerateTestID()))
+}
+
+func TestParseVerify(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blk := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{blk.ID(): blk}
+	state, err := NewState(newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	parse := func(b []byte) (block.Block, error) {
+		return blks.ParseBlock(ctx, b)
+	}
+	require.NoError(state.ParseVerify(ctx, blk.Bytes(), parse))
+
+	// The block went through the caches of State.
+	bw, ok := state.GetVerified(blk.ID())
+	require.True(ok)
+	parsed, err := state.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	require.Same(bw, parsed)
+
+	// Malformed bytes are reported as errors.
+	for _, b := range [][]byte{nil, {}, {0x01}, make([]byte, 64)} {
+		require.Error(state.ParseVerify(ctx, b, parse))
+	}
+	err = state.ParseVerify(ctx, []byte{0x02}, func([]byte) (block.Block, error) {
+		return nil, nil
+	})
+	require.ErrorIs(err, errNilBlock)
+}
+
+func TestSetLastAcceptedBlockBackwardsFlushesHeights(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	bws := newTestRange(t, state, genesis, 2)
+	require.NoError(state.AcceptRange(ctx, bws))
+	blkID, err := state.GetBlockIDAtHeight(ctx, 2)
+	require.NoError(err)
+	require.Equal(bws[1].ID(), blkID)
+
+	// Moving the last accepted block backwards drops the heights above it.
+	require.NoError(state.SetLastAcceptedBlock(genesis))
+	_, err = state.GetBlockIDAtHeight(ctx, 2)
+	require.ErrorIs(err, database.ErrNotFound)
+	blkID, err = state.GetBlockIDAtHeight(ctx, 0)
+	require.NoError(err)
+	require.Equal(genesis.ID(), blkID)
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+)
+
+var (
+	_ blockChainVM = (*StateVM)(nil)
+
+	errMissingDelegate = errors.New("missing delegate")
+)
+
+// blockChainVM is the subset of block.ChainVM that is implemented by StateVM.
+type blockChainVM interface {
+	GetBlock(context.Context, ids.ID) (block.Block, error)
+	ParseBlock(context.Context, []byte) (block.Block, error)
+	BuildBlock(context.Context) (block.Block, error)
+	SetPreference(context.Context, ids.ID) error
+	LastAccepted(context.Context) (ids.ID, error)
+}
+
+// StateVM implements the block methods of block.ChainVM on top of a State, so
+// that a VM only has to provide the raw operations on its blocks and gets the
+// caching for free. A VM typically embeds a StateVM and implements the
+// remaining methods of block.ChainVM itself.
+//
+// The raw operations are the delegates of the State's [Config]:
+//
+//   - GetBlock func(context.Context, ids.ID) (block.Block, error) loads a
+//     block from the VM's storage. It must return [database.ErrNotFound] if
+//     the block is unknown.
+//   - UnmarshalBlock func(context.Context, []byte) (block.Block, error)
+//     parses a block without verifying it.
+//   - BuildBlock func(context.Context) (block.Block, error) builds a new block
+//     on top of the preferred block.
+//
+// along with the delegate given to [NewStateVM]:
+//
+//   - SetPreference func(context.Context, ids.ID) error is called with the
+//     block preferred by consensus, once it was recorded by
+//     [State.SetPreference]. It may be nil if the VM relies on
+//     [State.Preference] instead.
+//
+// The blocks returned to consensus are the wrappers cached by State, so the
+// delegates are only called for blocks that aren't cached.
+type StateVM struct {
+	*State
+
+	setPreference func(context.Context, ids.ID) error
+}
+
+// NewStateVM returns a StateVM backed by [state]. [state] must have been
+// configured with [Config.GetBlock], [Config.UnmarshalBlock] and
+// [Config.BuildBlock]. [setPreference] may be nil.
+func NewStateVM(state *State, setPreference func(context.Context, ids.ID) error) (*StateVM, error) {
+	switch {
+	case state.getBlock == nil:
+		return nil, fmt.Errorf("%w: GetBlock", errMissingDelegate)
+	case state.unmarshalBlock == nil:
+		return nil, fmt.Errorf("%w: UnmarshalBlock", errMissingDelegate)
+	case state.buildBlock == nil:
+		return nil, fmt.Errorf("%w: BuildBlock", errMissingDelegate)
+	}
+	return &StateVM{
+		State:         state,
+		setPreference: setPreference,
+	}, nil
+}
+
+// SetPreference records [blkID], the block preferred by consensus, with
+// [State.SetPreference] and then passes it to the VM.
+func (vm *StateVM) SetPreference(ctx context.Context, blkID ids.ID) error {
+	if err := vm.State.SetPreference(blkID); err != nil {
+		return err
+	}
+	if vm.setPreference == nil {
+		return nil
+	}
+	return vm.setPreference(ctx, blkID)
+}
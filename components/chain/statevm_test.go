@@ -0,0 +1,80 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestNewStateVMMissingDelegate(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	_, err = NewStateVM(state, nil)
+	require.ErrorIs(err, errMissingDelegate)
+}
+
+func TestStateVM(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blk := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{blk.ID(): blk}
+	config := newTestConfig(genesis, blks)
+	built := chaintest.NewBlock(blk)
+	config.BuildBlock = func(context.Context) (block.Block, error) {
+		return built, nil
+	}
+	state, err := NewState(config)
+	require.NoError(err)
+
+	var preferred ids.ID
+	vm, err := NewStateVM(state, func(_ context.Context, blkID ids.ID) error {
+		preferred = blkID
+		return nil
+	})
+	require.NoError(err)
+
+	lastAccepted, err := vm.LastAccepted(ctx)
+	require.NoError(err)
+	require.Equal(genesis.ID(), lastAccepted)
+
+	parsed, err := vm.ParseBlock(ctx, blk.Bytes())
+	require.NoError(err)
+	got, err := vm.GetBlock(ctx, blk.ID())
+	require.NoError(err)
+	require.Same(parsed, got)
+
+	// The preference is validated before it is passed to the VM.
+	var unknownErr *UnknownPreferenceError
+	require.ErrorAs(vm.SetPreference(ctx, blk.ID()), &unknownErr)
+	require.Equal(ids.Empty, preferred)
+
+	require.NoError(parsed.Verify(ctx))
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+	require.Equal(blk.ID(), preferred)
+	require.Equal(blk.ID(), vm.Preference())
+
+	builtBlk, err := vm.BuildBlock(ctx)
+	require.NoError(err)
+	got, err = vm.GetBlock(ctx, built.ID())
+	require.NoError(err)
+	require.Same(builtBlk, got)
+
+	// A StateVM without a SetPreference delegate ignores the preference.
+	vm, err = NewStateVM(state, nil)
+	require.NoError(err)
+	require.NoError(vm.SetPreference(ctx, blk.ID()))
+}
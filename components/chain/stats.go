@@ -0,0 +1,125 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"time"
+
+	"github.com/luxfi/ids"
+)
+
+// Stats is a snapshot of the state of the caches of State, intended to be
+// reported by debugging endpoints.
+type Stats struct {
+	// Verified, Decided and Unverified describe the corresponding block
+	// caches.
+	Verified   CacheStats `json:"verified"`
+	Decided    CacheStats `json:"decided"`
+	Unverified CacheStats `json:"unverified"`
+	// Missing is the number of block IDs remembered as unknown to the VM.
+	Missing int `json:"missing"`
+	// Pending is the number of blocks waiting for their parent.
+	Pending int `json:"pending"`
+	// OldestProcessingAge is the time the oldest processing block has been
+	// processing, or zero if no block is processing.
+	OldestProcessingAge time.Duration `json:"oldestProcessingAge"`
+	// LastAcceptedID and LastAcceptedHeight identify the last accepted
+	// block. They are zero if there is no last accepted block.
+	LastAcceptedID     ids.ID `json:"lastAcceptedID"`
+	LastAcceptedHeight uint64 `json:"lastAcceptedHeight"`
+}
+
+// CacheStats describes a block cache of State.
+type CacheStats struct {
+	// Len is the number of blocks in the cache.
+	Len int `json:"len"`
+	// Hits and Misses are the number of lookups of the cache that found and
+	// didn't find a block. They are only counted by states created by
+	// [NewMeteredState], and are zero otherwise.
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// HitRate is the ratio of Hits to the number of lookups, or zero if
+	// there was no lookup.
+	HitRate float64 `json:"hitRate"`
+}
+
+func newCacheStats(length int, metrics *cacheMetrics) CacheStats {
+	stats := CacheStats{
+		Len: length,
+	}
+	if metrics == nil {
+		return stats
+	}
+	stats.Hits = metrics.numHits.Load()
+	stats.Misses = metrics.numMisses.Load()
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the caches of State. The verified blocks and the
+// last accepted block are read under a single acquisition of the State lock,
+// so they are consistent with each other. Stats only reads counters and
+// lengths, apart from scanning the processing blocks for the oldest one, so it
+// is cheap enough to be called on demand.
+func (s *State) Stats() Stats {
+	var verified, decided, unverified *cacheMetrics
+	if s.metrics != nil {
+		verified = &s.metrics.verified
+		decided = &s.metrics.decided
+		unverified = &s.metrics.unverified
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	stats := Stats{
+		Verified:            newCacheStats(s.verifiedBlocks.Len(), verified),
+		Decided:             newCacheStats(s.decidedBlocks.Len(), decided),
+		Unverified:          newCacheStats(s.unverifiedBlocks.Len(), unverified),
+		Missing:             s.missingBlocks.Len(),
+		Pending:             s.NumPending(),
+		OldestProcessingAge: s.oldestProcessingAge(),
+	}
+	if s.lastAcceptedBlock != nil {
+		stats.LastAcceptedID = s.lastAcceptedBlock.ID()
+		stats.LastAcceptedHeight = s.lastAcceptedBlock.Height()
+	}
+	return stats
+}
+
+// CacheUsage describes the capacity and contents of a block cache of State.
+type CacheUsage struct {
+	// Cap is the capacity of the cache. It is the byte budget of the decided
+	// and unverified caches, as configured by [Config.DecidedCacheSize] and
+	// [Config.UnverifiedCacheSize], and the number of blocks allowed by
+	// [Config.MaxProcessing] for the verified blocks. Zero means that the
+	// verified blocks are unbounded, or that the decided cache is disabled.
+	Cap int
+	// Len is the number of blocks in the cache.
+	Len int
+}
+
+// CacheInfo returns the usage of the verified, decided and unverified caches,
+// keyed by "verified", "decided" and "unverified". As the decided and
+// unverified caches are bounded by bytes rather than blocks, [State.Trim] may
+// be used to bring them under a byte target. CacheInfo doesn't take the State
+// lock, so the lengths may be slightly inconsistent with each other.
+func (s *State) CacheInfo() map[string]CacheUsage {
+	return map[string]CacheUsage{
+		verifiedLabel: {
+			Cap: s.maxProcessing,
+			Len: s.verifiedBlocks.Len(),
+		},
+		decidedLabel: {
+			Cap: s.decidedCacheSize,
+			Len: s.decidedBlocks.Len(),
+		},
+		unverifiedLabel: {
+			Cap: s.unverifiedCacheSize,
+			Len: s.unverifiedBlocks.Len(),
+		},
+	}
+}
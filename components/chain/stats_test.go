@@ -0,0 +1,119 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/metric"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestStats(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	blk1 := chaintest.NewBlock(genesis)
+	blk2 := chaintest.NewBlock(blk1)
+	blks := chaintest.Blocks{blk1.ID(): blk1, blk2.ID(): blk2}
+	state, err := NewMeteredState(metric.NewRegistry(), newTestConfig(genesis, blks))
+	require.NoError(err)
+
+	stats := state.Stats()
+	require.Equal(genesis.ID(), stats.LastAcceptedID)
+	require.Equal(genesis.Height(), stats.LastAcceptedHeight)
+	require.Zero(stats.Verified.Len)
+	require.Zero(stats.OldestProcessingAge)
+
+	bw1, err := state.GetBlock(ctx, blk1.ID())
+	require.NoError(err)
+	require.NoError(bw1.Verify(ctx))
+	_, err = state.GetBlock(ctx, blk1.ID())
+	require.NoError(err)
+
+	stats = state.Stats()
+	require.Equal(1, stats.Verified.Len)
+	require.Equal(uint64(1), stats.Verified.Hits)
+	require.Equal(float64(stats.Verified.Hits)/float64(stats.Verified.Hits+stats.Verified.Misses), stats.Verified.HitRate)
+	require.Positive(stats.OldestProcessingAge)
+	require.Zero(stats.Pending)
+
+	require.NoError(bw1.Accept(ctx))
+	stats = state.Stats()
+	require.Equal(blk1.ID(), stats.LastAcceptedID)
+	require.Equal(blk1.Height(), stats.LastAcceptedHeight)
+	require.Zero(stats.Verified.Len)
+
+	// The snapshot is serializable for debugging endpoints.
+	b, err := json.Marshal(stats)
+	require.NoError(err)
+	var decoded struct {
+		LastAcceptedID ids.ID `json:"lastAcceptedID"`
+	}
+	require.NoError(json.Unmarshal(b, &decoded))
+	require.Equal(blk1.ID(), decoded.LastAcceptedID)
+}
+
+func TestStatsUnmetered(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	_, err = state.GetBlock(context.Background(), genesis.ID())
+	require.NoError(err)
+
+	stats := state.Stats()
+	require.Zero(stats.Decided.Hits)
+	require.Zero(stats.Decided.HitRate)
+}
+
+func TestCacheInfo(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.Background()
+	genesis := chaintest.NewGenesis()
+	verified := chaintest.NewBlock(genesis)
+	unverified := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{verified.ID(): verified, unverified.ID(): unverified}
+	config := newTestConfig(genesis, blks)
+	config.MaxProcessing = 4
+	state, err := NewState(config)
+	require.NoError(err)
+
+	blk, err := state.GetBlock(ctx, verified.ID())
+	require.NoError(err)
+	require.NoError(blk.Verify(ctx))
+	_, err = state.GetBlock(ctx, unverified.ID())
+	require.NoError(err)
+
+	require.Equal(map[string]CacheUsage{
+		verifiedLabel: {
+			Cap: 4,
+			Len: 1,
+		},
+		decidedLabel: {
+			Cap: testCacheSize,
+			Len: state.decidedBlocks.Len(),
+		},
+		unverifiedLabel: {
+			Cap: testCacheSize,
+			Len: 1,
+		},
+	}, state.CacheInfo())
+	require.Positive(state.CacheInfo()[decidedLabel].Len)
+
+	// A disabled decided cache has no capacity.
+	config.DisableDecidedCache = true
+	state, err = NewState(config)
+	require.NoError(err)
+	require.Zero(state.CacheInfo()[decidedLabel].Cap)
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import "github.com/luxfi/ids"
+
+// Status is the status of a block as known by the caching layer of State.
+type Status uint8
+
+const (
+	// StatusUnknown means the block is not in any of the caches.
+	StatusUnknown Status = iota
+	// StatusUnverified means the block is cached but has not been verified.
+	StatusUnverified
+	// StatusProcessing means the block has been verified and is processing in
+	// consensus.
+	StatusProcessing
+	// StatusAccepted means the block has been accepted.
+	StatusAccepted
+	// StatusRejected means the block has been rejected, or is known to
+	// conflict with an accepted block.
+	StatusRejected
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusUnknown:
+		return "Unknown"
+	case StatusUnverified:
+		return "Unverified"
+	case StatusProcessing:
+		return "Processing"
+	case StatusAccepted:
+		return "Accepted"
+	case StatusRejected:
+		return "Rejected"
+	default:
+		return "Invalid status"
+	}
+}
+
+// Status returns the status of [blkID] as known by the caches, without
+// consulting the VM. Returns false if the block is not cached.
+func (s *State) Status(blkID ids.ID) (Status, bool) {
+	s.lock.RLock()
+	_, processing := s.verifiedBlocks.Get(blkID)
+	lastAccepted := s.lastAcceptedBlock != nil && s.lastAcceptedBlock.key() == blkID
+	s.lock.RUnlock()
+
+	switch {
+	case processing:
+		return StatusProcessing, true
+	case lastAccepted:
+		return StatusAccepted, true
+	}
+	if blk, ok := s.decidedBlocks.Get(blkID); ok {
+		if blk.accepted {
+			return StatusAccepted, true
+		}
+		return StatusRejected, true
+	}
+	if _, ok := s.unverifiedBlocks.Get(blkID); ok {
+		return StatusUnverified, true
+	}
+	return StatusUnknown, false
+}
+
+// CacheLocation is the block cache of State that holds a BlockWrapper.
+type CacheLocation uint8
+
+const (
+	// CacheLocationNone means the wrapper is not held by any block cache.
+	CacheLocationNone CacheLocation = iota
+	// CacheLocationUnverified means the wrapper is held by the unverified
+	// blocks.
+	CacheLocationUnverified
+	// CacheLocationVerified means the wrapper is held by the verified blocks.
+	CacheLocationVerified
+	// CacheLocationDecided means the wrapper is held by the decided blocks, or
+	// is the last accepted block.
+	CacheLocationDecided
+)
+
+func (l CacheLocation) String() string {
+	switch l {
+	case CacheLocationNone:
+		return "None"
+	case CacheLocationUnverified:
+		return "Unverified"
+	case CacheLocationVerified:
+		return "Verified"
+	case CacheLocationDecided:
+		return "Decided"
+	default:
+		return "Invalid cache location"
+	}
+}
+
+// CacheLocation returns the block cache that holds [bw]. Caches holding a
+// different wrapper of the same block are not reported, so a block that is
+// cached under another wrapper is reported as [CacheLocationNone]. Use
+// [State.Status] to look up a block regardless of its wrapper.
+func (bw *BlockWrapper) CacheLocation() CacheLocation {
+	s := bw.state
+	blkID := bw.key()
+	s.lock.RLock()
+	verifiedBlk, _ := s.verifiedBlocks.Get(blkID)
+	lastAcceptedBlk := s.lastAcceptedBlock
+	s.lock.RUnlock()
+
+	switch bw {
+	case verifiedBlk:
+		return CacheLocationVerified
+	case lastAcceptedBlk:
+		return CacheLocationDecided
+	}
+	if blk, ok := s.decidedBlocks.Get(blkID); ok && blk.BlockWrapper == bw {
+		return CacheLocationDecided
+	}
+	if blk, ok := s.unverifiedBlocks.Get(blkID); ok && blk == bw {
+		return CacheLocationUnverified
+	}
+	return CacheLocationNone
+}
@@ -0,0 +1,123 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+func TestStateStatus(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		child.ID(): child,
+	}))
+	require.NoError(err)
+
+	status, ok := state.Status(genesis.ID())
+	require.True(ok)
+	require.Equal(StatusAccepted, status)
+
+	status, ok = state.Status(child.ID())
+	require.False(ok)
+	require.Equal(StatusUnknown, status)
+
+	ctx := context.Background()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	status, ok = state.Status(child.ID())
+	require.True(ok)
+	require.Equal(StatusUnverified, status)
+
+	require.NoError(blk.Verify(ctx))
+	status, ok = state.Status(child.ID())
+	require.True(ok)
+	require.Equal(StatusProcessing, status)
+
+	require.NoError(blk.Accept(ctx))
+	status, ok = state.Status(child.ID())
+	require.True(ok)
+	require.Equal(StatusAccepted, status)
+
+	status, ok = state.Status(ids.GenerateTestID())
+	require.False(ok)
+	require.Equal(StatusUnknown, status)
+}
+
+func TestStateStatusRejected(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	accepted := chaintest.NewBlock(genesis)
+	rejected := chaintest.NewBlock(genesis)
+	conflicting := chaintest.NewBlock(genesis)
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{
+		conflicting.ID(): conflicting,
+	}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	acceptedBlk := state.WrapBlock(accepted)
+	rejectedBlk := state.WrapBlock(rejected)
+	require.NoError(acceptedBlk.Verify(ctx))
+	require.NoError(rejectedBlk.Verify(ctx))
+	require.NoError(acceptedBlk.Accept(ctx))
+	require.NoError(rejectedBlk.Reject(ctx))
+
+	status, ok := state.Status(accepted.ID())
+	require.True(ok)
+	require.Equal(StatusAccepted, status)
+
+	status, ok = state.Status(rejected.ID())
+	require.True(ok)
+	require.Equal(StatusRejected, status)
+
+	// Blocks loaded at an accepted height that weren't accepted conflict with
+	// the accepted block.
+	_, err = state.GetBlock(ctx, conflicting.ID())
+	require.NoError(err)
+	status, ok = state.Status(conflicting.ID())
+	require.True(ok)
+	require.Equal(StatusRejected, status)
+}
+
+func TestBlockWrapperCacheLocation(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	state, err := NewState(newTestConfig(genesis, chaintest.Blocks{}))
+	require.NoError(err)
+
+	ctx := context.Background()
+	child := chaintest.NewBlock(genesis)
+	blk := state.WrapBlock(child)
+	require.Equal(CacheLocationUnverified, blk.CacheLocation())
+
+	require.NoError(blk.Verify(ctx))
+	require.Equal(CacheLocationVerified, blk.CacheLocation())
+
+	// Other wrappers of the same block aren't cached.
+	other := &BlockWrapper{Block: child, state: state}
+	require.Equal(CacheLocationNone, other.CacheLocation())
+
+	sibling := state.WrapBlock(chaintest.NewBlock(genesis))
+	require.NoError(sibling.Verify(ctx))
+	require.NoError(blk.Accept(ctx))
+	require.NoError(sibling.Reject(ctx))
+	require.Equal(CacheLocationDecided, blk.CacheLocation())
+	require.Equal(CacheLocationDecided, sibling.CacheLocation())
+
+	// The last accepted block outlives the caches.
+	state.Flush()
+	require.Equal(CacheLocationDecided, blk.CacheLocation())
+	require.Equal(CacheLocationNone, sibling.CacheLocation())
+}
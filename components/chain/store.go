@@ -0,0 +1,60 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+)
+
+// DecidedStore is a persistent store of the bytes of accepted blocks, keyed by
+// block ID, that backs the in-memory cache of decided blocks.
+type DecidedStore interface {
+	// Get returns the bytes of the block [blkID], or [database.ErrNotFound]
+	// if the block isn't in the store.
+	Get(blkID ids.ID) ([]byte, error)
+	// Put writes the bytes of the accepted block [blkID] to the store.
+	Put(blkID ids.ID, blkBytes []byte) error
+}
+
+// getStoredBlock reads [blkID] from the decided store, if there is one.
+// Returns false if the block isn't available from the store, in which case
+// the block should be loaded from the VM.
+func (s *State) getStoredBlock(ctx context.Context, blkID ids.ID) (block.Block, bool) {
+	if s.decidedStore == nil {
+		return nil, false
+	}
+
+	blkBytes, err := s.decidedStore.Get(blkID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, false
+	}
+	if err != nil {
+		s.metrics.decidedStoreError()
+		return nil, false
+	}
+
+	blk, err := s.unmarshalBlock(ctx, blkBytes)
+	if err != nil || s.key(blk) != blkID {
+		s.metrics.decidedStoreError()
+		return nil, false
+	}
+	return blk, true
+}
+
+// storeAcceptedBlock writes [bw] to the decided store, if there is one.
+// Failures are counted but otherwise ignored, as the block can always be
+// loaded from the VM.
+func (s *State) storeAcceptedBlock(bw *BlockWrapper) {
+	if s.decidedStore == nil {
+		return
+	}
+	if err := s.decidedStore.Put(bw.key(), bw.Bytes()); err != nil {
+		s.metrics.decidedStoreError()
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/database"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/metric"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var errTestStore = errors.New("test store error")
+
+// testStore is an in-memory DecidedStore. All operations fail with [err] if
+// it is set.
+type testStore struct {
+	blks map[ids.ID][]byte
+	err  error
+}
+
+func (s *testStore) Get(blkID ids.ID) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	blkBytes, ok := s.blks[blkID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return blkBytes, nil
+}
+
+func (s *testStore) Put(blkID ids.ID, blkBytes []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.blks[blkID] = blkBytes
+	return nil
+}
+
+func TestDecidedStore(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	store := &testStore{blks: make(map[ids.ID][]byte)}
+	blks := chaintest.Blocks{}
+	config := newTestConfig(genesis, blks)
+	config.DecidedStore = store
+	state, err := NewState(config)
+	require.NoError(err)
+
+	ctx := context.Background()
+	bw := state.WrapBlock(child)
+	require.NoError(bw.Verify(ctx))
+	require.NoError(bw.Accept(ctx))
+	require.Equal(child.Bytes(), store.blks[child.ID()])
+
+	// A fresh state reads the block from the store rather than the VM.
+	blks[child.ID()] = child
+	config.LastAcceptedBlock = child
+	config.GetBlock = func(context.Context, ids.ID) (block.Block, error) {
+		return nil, database.ErrNotFound
+	}
+	state, err = NewState(config)
+	require.NoError(err)
+	state.Flush()
+
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.Equal(child, blk.(*BlockWrapper).Block)
+
+	// Blocks missing from the store fall back to the VM.
+	_, err = state.GetBlock(ctx, genesis.ID())
+	require.ErrorIs(err, database.ErrNotFound)
+}
+
+func TestDecidedStoreErrors(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	child := chaintest.NewBlock(genesis)
+	blks := chaintest.Blocks{}
+	config := newTestConfig(genesis, blks)
+	config.DecidedStore = &testStore{err: errTestStore}
+	registry := metric.NewRegistry()
+	state, err := NewMeteredState(registry, config)
+	require.NoError(err)
+
+	// Failing to write to the store doesn't fail Accept.
+	ctx := context.Background()
+	bw := state.WrapBlock(child)
+	require.NoError(bw.Verify(ctx))
+	require.NoError(bw.Accept(ctx))
+	require.Equal(child.ID(), state.LastAcceptedID())
+	m := gatherMetric(t, registry, "chain_state_decided_store_errors", "", "")
+	require.Equal(1.0, m.GetCounter().GetValue())
+
+	// Failing to read from the store falls back to the VM.
+	blks[child.ID()] = child
+	state.Flush()
+	blk, err := state.GetBlock(ctx, child.ID())
+	require.NoError(err)
+	require.Equal(child, blk.(*BlockWrapper).Block)
+	m = gatherMetric(t, registry, "chain_state_decided_store_errors", "", "")
+	require.Equal(2.0, m.GetCounter().GetValue())
+}
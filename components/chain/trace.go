@@ -0,0 +1,46 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+
+	"github.com/luxfi/ids"
+)
+
+const (
+	verifySpan            = "chain.Verify"
+	verifyWithContextSpan = "chain.VerifyWithContext"
+	acceptSpan            = "chain.Accept"
+	rejectSpan            = "chain.Reject"
+)
+
+// Tracer starts the spans that trace the lifecycle of blocks, such as by
+// adapting an OpenTelemetry tracer.
+type Tracer interface {
+	// StartSpan starts a span named [name] for the block [blkID] at [height],
+	// as a child of the span in [ctx] if any. The returned context carries the
+	// new span and is passed to the underlying block.
+	StartSpan(ctx context.Context, name string, blkID ids.ID, height uint64) (context.Context, Span)
+}
+
+// Span is a span started by a [Tracer].
+type Span interface {
+	// End ends the span. [err] is the error the traced operation failed
+	// with, or nil if it succeeded.
+	End(err error)
+}
+
+func noopEnd(error) {}
+
+// startSpan starts a span named [name] for [bw] with [Config.Tracer], and
+// returns the context to use for the traced operation along with the function
+// that ends the span. If no tracer is configured, [ctx] is returned as is.
+func (s *State) startSpan(ctx context.Context, name string, bw *BlockWrapper) (context.Context, func(error)) {
+	if s.tracer == nil {
+		return ctx, noopEnd
+	}
+	ctx, span := s.tracer.StartSpan(ctx, name, bw.ID(), bw.Height())
+	return ctx, span.End
+}
@@ -0,0 +1,166 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/consensus/engine/chain/block"
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	name   string
+	blkID  ids.ID
+	height uint64
+	parent *testSpan
+	ended  bool
+	err    error
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, name string, blkID ids.ID, height uint64) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*testSpan)
+	span := &testSpan{
+		name:   name,
+		blkID:  blkID,
+		height: height,
+		parent: parent,
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// spanBlock records the span in the context it is verified and decided with.
+type spanBlock struct {
+	*testContextBlock
+
+	spans []*testSpan
+}
+
+func (b *spanBlock) record(ctx context.Context) {
+	span, _ := ctx.Value(spanKey{}).(*testSpan)
+	b.spans = append(b.spans, span)
+}
+
+func (b *spanBlock) Verify(ctx context.Context) error {
+	b.record(ctx)
+	return b.testContextBlock.Verify(ctx)
+}
+
+func (b *spanBlock) VerifyWithContext(ctx context.Context, blockCtx *block.Context) error {
+	b.record(ctx)
+	return b.testContextBlock.VerifyWithContext(ctx, blockCtx)
+}
+
+func (b *spanBlock) Accept(ctx context.Context) error {
+	b.record(ctx)
+	return b.testContextBlock.Accept(ctx)
+}
+
+func (b *spanBlock) Reject(ctx context.Context) error {
+	b.record(ctx)
+	return b.testContextBlock.Reject(ctx)
+}
+
+func TestTracer(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	tracer := &testTracer{}
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.Tracer = tracer
+	state, err := NewState(config)
+	require.NoError(err)
+
+	root := &testSpan{name: "root"}
+	ctx := context.WithValue(context.Background(), spanKey{}, root)
+	accepted := &spanBlock{testContextBlock: &testContextBlock{
+		Block:                   chaintest.NewBlock(genesis),
+		shouldVerifyWithContext: true,
+	}}
+	rejected := &spanBlock{testContextBlock: &testContextBlock{
+		Block: chaintest.NewBlock(genesis),
+	}}
+	rejected.VerifyV = errTestVerify
+	acceptedBw := state.WrapBlock(accepted)
+	rejectedBw := state.WrapBlock(rejected)
+
+	require.NoError(acceptedBw.VerifyWithContext(ctx, &block.Context{}))
+	require.ErrorIs(rejectedBw.Verify(ctx), errTestVerify)
+	require.NoError(acceptedBw.Accept(ctx))
+	require.NoError(rejectedBw.Reject(ctx))
+
+	require.Len(tracer.spans, 4)
+	expected := []struct {
+		name string
+		blk  *spanBlock
+		err  error
+	}{
+		{name: verifyWithContextSpan, blk: accepted},
+		{name: verifySpan, blk: rejected, err: errTestVerify},
+		{name: acceptSpan, blk: accepted},
+		{name: rejectSpan, blk: rejected},
+	}
+	for i, expected := range expected {
+		span := tracer.spans[i]
+		require.Equal(expected.name, span.name)
+		require.Equal(expected.blk.ID(), span.blkID)
+		require.Equal(expected.blk.Height(), span.height)
+		require.Same(root, span.parent)
+		require.True(span.ended)
+		require.ErrorIs(span.err, expected.err)
+	}
+
+	// The underlying blocks are called with the context of their spans.
+	require.Equal([]*testSpan{tracer.spans[0], tracer.spans[2]}, accepted.spans)
+	require.Equal([]*testSpan{tracer.spans[1], tracer.spans[3]}, rejected.spans)
+}
+
+func TestTracerAcceptRange(t *testing.T) {
+	require := require.New(t)
+
+	genesis := chaintest.NewGenesis()
+	tracer := &testTracer{}
+	config := newTestConfig(genesis, chaintest.Blocks{})
+	config.Tracer = tracer
+	state, err := NewState(config)
+	require.NoError(err)
+
+	bws := newTestRange(t, state, genesis, 4)
+	bws[2].Block.(*chaintest.Block).AcceptV = errTestVerify
+	tracer.spans = nil
+
+	root := &testSpan{name: "root"}
+	ctx := context.WithValue(context.Background(), spanKey{}, root)
+	require.ErrorIs(state.AcceptRange(ctx, bws), errTestVerify)
+
+	// A span is started for every block whose underlying Accept was called,
+	// as for single accepts.
+	require.Len(tracer.spans, 3)
+	for i, span := range tracer.spans {
+		require.Equal(acceptSpan, span.name)
+		require.Equal(bws[i].ID(), span.blkID)
+		require.Equal(bws[i].Height(), span.height)
+		require.Same(root, span.parent)
+		require.True(span.ended)
+	}
+	require.NoError(tracer.spans[0].err)
+	require.NoError(tracer.spans[1].err)
+	require.ErrorIs(tracer.spans[2].err, errTestVerify)
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/luxfi/ids"
+)
+
+var (
+	_ VerifiedMap = PlainMap{}
+	_ VerifiedMap = ShardedMap{}
+
+	_ verifiedBlocks = (*plainVerifiedBlocks)(nil)
+	_ verifiedBlocks = (*shardedVerifiedBlocks)(nil)
+)
+
+// verifiedBlocks holds the blocks that have been verified and are therefore
+// currently in consensus. Implementations are safe for concurrent use.
+type verifiedBlocks interface {
+	Get(blkID ids.ID) (*BlockWrapper, bool)
+	Put(blkID ids.ID, blk *BlockWrapper)
+	Delete(blkID ids.ID)
+	Len() int
+	Clear()
+	// Range calls [f] with every block until [f] returns false. [f] must not
+	// call into the verifiedBlocks.
+	Range(f func(ids.ID, *BlockWrapper) bool)
+}
+
+// VerifiedMap determines how State holds the verified blocks.
+type VerifiedMap interface {
+	newVerifiedBlocks() verifiedBlocks
+}
+
+// PlainMap holds the verified blocks in a single map guarded by a single lock.
+// This is the default.
+type PlainMap struct{}
+
+func (PlainMap) newVerifiedBlocks() verifiedBlocks {
+	return &plainVerifiedBlocks{
+		blks: make(map[ids.ID]*BlockWrapper),
+	}
+}
+
+// ShardedMap spreads the verified blocks over [Shards] maps, each guarded by
+// its own lock, to reduce the contention between concurrent lookups of
+// different blocks. Adding and removing verified blocks is still serialized
+// by State. If [Shards] is less than 2, a [PlainMap] is used.
+type ShardedMap struct {
+	Shards int
+}
+
+func (m ShardedMap) newVerifiedBlocks() verifiedBlocks {
+	if m.Shards < 2 {
+		return PlainMap{}.newVerifiedBlocks()
+	}
+	shards := make([]plainVerifiedBlocks, m.Shards)
+	for i := range shards {
+		shards[i].blks = make(map[ids.ID]*BlockWrapper)
+	}
+	return &shardedVerifiedBlocks{
+		shards: shards,
+	}
+}
+
+type plainVerifiedBlocks struct {
+	lock sync.RWMutex
+	blks map[ids.ID]*BlockWrapper
+}
+
+func (p *plainVerifiedBlocks) Get(blkID ids.ID) (*BlockWrapper, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	blk, ok := p.blks[blkID]
+	return blk, ok
+}
+
+func (p *plainVerifiedBlocks) Put(blkID ids.ID, blk *BlockWrapper) {
+	p.put(blkID, blk)
+}
+
+// put adds [blk] and returns true if [blkID] wasn't already present.
+func (p *plainVerifiedBlocks) put(blkID ids.ID, blk *BlockWrapper) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, ok := p.blks[blkID]
+	p.blks[blkID] = blk
+	return !ok
+}
+
+func (p *plainVerifiedBlocks) Delete(blkID ids.ID) {
+	p.delete(blkID)
+}
+
+// delete removes [blkID] and returns true if it was present.
+func (p *plainVerifiedBlocks) delete(blkID ids.ID) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, ok := p.blks[blkID]
+	delete(p.blks, blkID)
+	return ok
+}
+
+func (p *plainVerifiedBlocks) Len() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.blks)
+}
+
+func (p *plainVerifiedBlocks) Clear() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	clear(p.blks)
+}
+
+func (p *plainVerifiedBlocks) Range(f func(ids.ID, *BlockWrapper) bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	for blkID, blk := range p.blks {
+		if !f(blkID, blk) {
+			return
+		}
+	}
+}
+
+type shardedVerifiedBlocks struct {
+	shards []plainVerifiedBlocks
+	// numBlks is the number of blocks across all shards, so that Len doesn't
+	// lock every shard.
+	numBlks atomic.Int64
+}
+
+// shard returns the shard holding [blkID]. Block IDs are hashes, so their
+// leading bytes spread the blocks evenly.
+func (s *shardedVerifiedBlocks) shard(blkID ids.ID) *plainVerifiedBlocks {
+	i := binary.BigEndian.Uint64(blkID[:8]) % uint64(len(s.shards))
+	return &s.shards[i]
+}
+
+func (s *shardedVerifiedBlocks) Get(blkID ids.ID) (*BlockWrapper, bool) {
+	return s.shard(blkID).Get(blkID)
+}
+
+func (s *shardedVerifiedBlocks) Put(blkID ids.ID, blk *BlockWrapper) {
+	if s.shard(blkID).put(blkID, blk) {
+		s.numBlks.Add(1)
+	}
+}
+
+func (s *shardedVerifiedBlocks) Delete(blkID ids.ID) {
+	if s.shard(blkID).delete(blkID) {
+		s.numBlks.Add(-1)
+	}
+}
+
+func (s *shardedVerifiedBlocks) Len() int {
+	return int(s.numBlks.Load())
+}
+
+func (s *shardedVerifiedBlocks) Clear() {
+	for i := range s.shards {
+		s.shards[i].Clear()
+	}
+	s.numBlks.Store(0)
+}
+
+func (s *shardedVerifiedBlocks) Range(f func(ids.ID, *BlockWrapper) bool) {
+	for i := range s.shards {
+		more := true
+		s.shards[i].Range(func(blkID ids.ID, blk *BlockWrapper) bool {
+			more = f(blkID, blk)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
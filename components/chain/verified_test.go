@@ -0,0 +1,120 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package chain
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/ids"
+	"github.com/luxfi/vms/components/chain/chaintest"
+)
+
+var testVerifiedMaps = []VerifiedMap{
+	PlainMap{},
+	ShardedMap{Shards: 4},
+}
+
+func TestVerifiedBlocks(t *testing.T) {
+	for _, verifiedMap := range testVerifiedMaps {
+		t.Run(fmt.Sprintf("%T", verifiedMap), func(t *testing.T) {
+			require := require.New(t)
+
+			blks := verifiedMap.newVerifiedBlocks()
+			blk0 := &BlockWrapper{Block: chaintest.NewBlock(chaintest.NewGenesis())}
+			blk1 := &BlockWrapper{Block: chaintest.NewBlock(chaintest.NewGenesis())}
+			blks.Put(blk0.ID(), blk0)
+			blks.Put(blk1.ID(), blk1)
+			require.Equal(2, blks.Len())
+
+			blk, ok := blks.Get(blk0.ID())
+			require.True(ok)
+			require.Same(blk0, blk)
+
+			ranged := make(map[ids.ID]*BlockWrapper)
+			blks.Range(func(blkID ids.ID, blk *BlockWrapper) bool {
+				ranged[blkID] = blk
+				return true
+			})
+			require.Equal(map[ids.ID]*BlockWrapper{
+				blk0.ID(): blk0,
+				blk1.ID(): blk1,
+			}, ranged)
+
+			var numRanged int
+			blks.Range(func(ids.ID, *BlockWrapper) bool {
+				numRanged++
+				return false
+			})
+			require.Equal(1, numRanged)
+
+			blks.Delete(blk0.ID())
+			_, ok = blks.Get(blk0.ID())
+			require.False(ok)
+			require.Equal(1, blks.Len())
+
+			blks.Clear()
+			require.Zero(blks.Len())
+		})
+	}
+}
+
+func TestStateVerifiedMap(t *testing.T) {
+	for _, verifiedMap := range testVerifiedMaps {
+		t.Run(fmt.Sprintf("%T", verifiedMap), func(t *testing.T) {
+			require := require.New(t)
+
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.VerifiedMap = verifiedMap
+			config.CascadeReject = true
+			state, err := NewState(config)
+			require.NoError(err)
+
+			ctx := context.Background()
+			parentBlk := chaintest.NewBlock(genesis)
+			parent := state.WrapBlock(parentBlk)
+			child := state.WrapBlock(chaintest.NewBlock(parentBlk))
+			require.NoError(parent.Verify(ctx))
+			require.NoError(child.Verify(ctx))
+			require.Len(state.ProcessingBlocks(), 2)
+			require.True(state.IsProcessing(child.ID()))
+
+			require.NoError(parent.Reject(ctx))
+			require.Empty(state.ProcessingBlocks())
+		})
+	}
+}
+
+// BenchmarkVerify compares the throughput of concurrently verifying siblings
+// with each [VerifiedMap].
+func BenchmarkVerify(b *testing.B) {
+	for _, verifiedMap := range []VerifiedMap{
+		PlainMap{},
+		ShardedMap{Shards: 16},
+	} {
+		b.Run(fmt.Sprintf("%T", verifiedMap), func(b *testing.B) {
+			genesis := chaintest.NewGenesis()
+			config := newTestConfig(genesis, chaintest.Blocks{})
+			config.VerifiedMap = verifiedMap
+			state, err := NewState(config)
+			require.NoError(b, err)
+
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					blk := state.WrapBlock(chaintest.NewBlock(genesis))
+					if err := blk.Verify(ctx); err != nil {
+						b.Error(err)
+						return
+					}
+					_ = state.IsProcessing(blk.ID())
+				}
+			})
+		})
+	}
+}
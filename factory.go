@@ -4,9 +4,255 @@
 // Package vms provides VM factory interfaces.
 package vms
 
-import "github.com/luxfi/log"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/luxfi/log"
+)
+
+var (
+	_ Factory           = FactoryFunc(nil)
+	_ TypedFactory[any] = (*typedFactory[any])(nil)
+
+	errConfigNotSupported = errors.New("factory does not support config")
+	errInvalidConfig      = errors.New("invalid config")
+	errUnexpectedConfig   = errors.New("unexpected config type")
+	errUnexpectedVMType   = errors.New("unexpected VM type")
+	errMissingCapability  = errors.New("missing capability")
+)
 
 // Factory creates new instances of a VM.
 type Factory interface {
 	New(log.Logger) (interface{}, error)
 }
+
+// FactoryFunc adapts an ordinary function into a Factory, in the same way as
+// http.HandlerFunc.
+type FactoryFunc func(log.Logger) (interface{}, error)
+
+// New calls f(log).
+func (f FactoryFunc) New(log log.Logger) (interface{}, error) {
+	return f(log)
+}
+
+// FactoryWithConfig is a Factory that is able to create a VM from its
+// configuration.
+//
+// Implementations are expected to implement New by calling NewWithConfig with
+// a nil config.
+type FactoryWithConfig interface {
+	Factory
+
+	// NewWithConfig creates a new instance of the VM configured by
+	// [configBytes]. [ctx] may be cancelled to abort a slow initialization,
+	// such as during node shutdown.
+	NewWithConfig(ctx context.Context, log log.Logger, configBytes []byte) (interface{}, error)
+}
+
+// ConfigurableFactory is a Factory that parses its configuration separately
+// from creating a VM, so that invalid configurations are reported before any
+// VM is created.
+type ConfigurableFactory interface {
+	Factory
+
+	// ParseConfig parses and validates [configBytes], applying defaults, and
+	// returns the resulting config. Errors should describe the invalid
+	// fields, as they are reported to the operator.
+	ParseConfig(configBytes []byte) (interface{}, error)
+
+	// NewWithParsedConfig creates a new instance of the VM configured by
+	// [config], as returned by ParseConfig. [ctx] may be cancelled to abort a
+	// slow initialization, such as during node shutdown.
+	NewWithParsedConfig(ctx context.Context, log log.Logger, config interface{}) (interface{}, error)
+}
+
+// ParseConfig parses [configBytes] with [f] if it implements
+// ConfigurableFactory, and returns the config to pass to NewWithParsedConfig.
+// This allows the node to report invalid configurations before creating the
+// VM.
+//
+// If [f] does not implement ConfigurableFactory, [configBytes] is returned as
+// is. It must be empty unless [f] implements FactoryWithConfig.
+func ParseConfig(f Factory, configBytes []byte) (interface{}, error) {
+	switch f := f.(type) {
+	case ConfigurableFactory:
+		config, err := f.ParseConfig(configBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidConfig, err)
+		}
+		return config, nil
+	case FactoryWithConfig:
+		return configBytes, nil
+	}
+	if len(configBytes) != 0 {
+		return nil, errConfigNotSupported
+	}
+	return configBytes, nil
+}
+
+// NewWithParsedConfig creates a new VM from [f] configured by [config], as
+// returned by ParseConfig.
+func NewWithParsedConfig(ctx context.Context, f Factory, log log.Logger, config interface{}) (interface{}, error) {
+	if f, ok := f.(ConfigurableFactory); ok {
+		return f.NewWithParsedConfig(ctx, log, config)
+	}
+	configBytes, ok := config.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: expected []byte but got %T", errUnexpectedConfig, config)
+	}
+	return NewWithConfig(ctx, f, log, configBytes)
+}
+
+// NewWithConfig creates a new VM from [f], passing [configBytes] through if
+// [f] implements FactoryWithConfig. If [f] implements ConfigurableFactory,
+// [configBytes] is parsed before the VM is created.
+//
+// If [f] implements neither, [configBytes] must be empty.
+func NewWithConfig(ctx context.Context, f Factory, log log.Logger, configBytes []byte) (interface{}, error) {
+	if f, ok := f.(ConfigurableFactory); ok {
+		config, err := ParseConfig(f, configBytes)
+		if err != nil {
+			return nil, err
+		}
+		return f.NewWithParsedConfig(ctx, log, config)
+	}
+	if f, ok := f.(FactoryWithConfig); ok {
+		return f.NewWithConfig(ctx, log, configBytes)
+	}
+	if len(configBytes) != 0 {
+		return nil, errConfigNotSupported
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.New(log)
+}
+
+// HealthyFactory is a Factory that is able to report whether it can create a
+// working VM.
+type HealthyFactory interface {
+	Factory
+
+	// HealthCheck returns nil if the factory is able to create a working VM.
+	// The returned details are intended to be reported by the node's health
+	// API.
+	HealthCheck(ctx context.Context) (interface{}, error)
+}
+
+// HealthCheck reports the health of [f] if it implements HealthyFactory.
+// Factories that don't implement HealthyFactory are reported as healthy.
+func HealthCheck(ctx context.Context, f Factory) (interface{}, error) {
+	if f, ok := f.(HealthyFactory); ok {
+		return f.HealthCheck(ctx)
+	}
+	return nil, nil
+}
+
+// Capabilities is a set of node features that a VM may require.
+type Capabilities uint64
+
+const (
+	// StateSync is required by VMs that bootstrap by syncing their state.
+	StateSync Capabilities = 1 << iota
+	// ContextVerification is required by VMs whose blocks must be verified
+	// with a block context.
+	ContextVerification
+	// WarpMessenger is required by VMs that send or verify Warp messages.
+	WarpMessenger
+)
+
+// DefaultCapabilities is the set of capabilities assumed to be required by
+// factories that don't implement CapableFactory. It is empty, so that VMs
+// that predate capabilities keep being loaded by every node.
+const DefaultCapabilities Capabilities = 0
+
+var capabilityNames = []struct {
+	capability Capabilities
+	name       string
+}{
+	{StateSync, "StateSync"},
+	{ContextVerification, "ContextVerification"},
+	{WarpMessenger, "WarpMessenger"},
+}
+
+// Has returns true if [c] includes all of [capabilities].
+func (c Capabilities) Has(capabilities Capabilities) bool {
+	return c&capabilities == capabilities
+}
+
+func (c Capabilities) String() string {
+	var names []string
+	for _, capability := range capabilityNames {
+		if c.Has(capability.capability) {
+			names = append(names, capability.name)
+			c &^= capability.capability
+		}
+	}
+	if c != 0 {
+		names = append(names, fmt.Sprintf("0x%x", uint64(c)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// CapableFactory is a Factory that declares the node capabilities required
+// by the VMs it creates.
+type CapableFactory interface {
+	Factory
+
+	// Capabilities returns the capabilities that the node must provide for
+	// the VM to work.
+	Capabilities() Capabilities
+}
+
+// RequiredCapabilities returns the capabilities required by [f] if it
+// implements CapableFactory, and [DefaultCapabilities] otherwise.
+func RequiredCapabilities(f Factory) Capabilities {
+	if f, ok := f.(CapableFactory); ok {
+		return f.Capabilities()
+	}
+	return DefaultCapabilities
+}
+
+// CheckCapabilities returns an error if [f] requires capabilities that are not
+// in [enabled], the capabilities provided by the node. This allows the node to
+// refuse to create a chain before the VM is created.
+func CheckCapabilities(f Factory, enabled Capabilities) error {
+	if missing := RequiredCapabilities(f) &^ enabled; missing != 0 {
+		return fmt.Errorf("%w: %s", errMissingCapability, missing)
+	}
+	return nil
+}
+
+// TypedFactory creates new instances of a VM of type T.
+type TypedFactory[T any] interface {
+	New(log.Logger) (T, error)
+}
+
+// NewTypedFactory adapts [f] into a TypedFactory. Every VM produced by [f] is
+// checked to be a T, and an error is returned if it is not.
+func NewTypedFactory[T any](f Factory) TypedFactory[T] {
+	return &typedFactory[T]{factory: f}
+}
+
+type typedFactory[T any] struct {
+	factory Factory
+}
+
+func (f *typedFactory[T]) New(log log.Logger) (T, error) {
+	var zero T
+	vmIntf, err := f.factory.New(log)
+	if err != nil {
+		return zero, err
+	}
+	vm, ok := vmIntf.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: expected %T but got %T", errUnexpectedVMType, zero, vmIntf)
+	}
+	return vm, nil
+}
@@ -0,0 +1,298 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/log"
+)
+
+var (
+	_ Factory             = (*testFactory)(nil)
+	_ FactoryWithConfig   = (*testConfigFactory)(nil)
+	_ HealthyFactory      = (*testHealthyFactory)(nil)
+	_ ConfigurableFactory = (*testParsingFactory)(nil)
+	_ CapableFactory      = (*testCapableFactory)(nil)
+
+	errTestUnhealthy     = errors.New("test unhealthy")
+	errTestInvalidConfig = errors.New("test invalid config")
+)
+
+type testVM struct {
+	configBytes []byte
+}
+
+type testFactory struct{}
+
+func (testFactory) New(log.Logger) (interface{}, error) {
+	return &testVM{}, nil
+}
+
+type testConfigFactory struct{}
+
+func (f testConfigFactory) New(log log.Logger) (interface{}, error) {
+	return f.NewWithConfig(context.Background(), log, nil)
+}
+
+func (testConfigFactory) NewWithConfig(_ context.Context, _ log.Logger, configBytes []byte) (interface{}, error) {
+	return &testVM{configBytes: configBytes}, nil
+}
+
+type testParsedConfig struct {
+	name string
+}
+
+// testParsingFactory rejects empty configs and uses the config bytes as the
+// name of the config.
+type testParsingFactory struct{}
+
+func (f testParsingFactory) New(log log.Logger) (interface{}, error) {
+	return f.NewWithParsedConfig(context.Background(), log, testParsedConfig{})
+}
+
+func (testParsingFactory) ParseConfig(configBytes []byte) (interface{}, error) {
+	if len(configBytes) == 0 {
+		return nil, errTestInvalidConfig
+	}
+	return testParsedConfig{name: string(configBytes)}, nil
+}
+
+func (testParsingFactory) NewWithParsedConfig(_ context.Context, _ log.Logger, config interface{}) (interface{}, error) {
+	return config, nil
+}
+
+type testHealthyFactory struct {
+	testFactory
+
+	details interface{}
+	err     error
+}
+
+func (f testHealthyFactory) HealthCheck(context.Context) (interface{}, error) {
+	return f.details, f.err
+}
+
+type testCapableFactory struct {
+	testFactory
+
+	capabilities Capabilities
+}
+
+func (f testCapableFactory) Capabilities() Capabilities {
+	return f.capabilities
+}
+
+func TestNewWithConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		factory     Factory
+		configBytes []byte
+		expectedVM  interface{}
+		expectedErr error
+	}{
+		{
+			name:        "config passed through",
+			factory:     testConfigFactory{},
+			configBytes: []byte("config"),
+			expectedVM:  &testVM{configBytes: []byte("config")},
+		},
+		{
+			name:       "legacy factory without config",
+			factory:    testFactory{},
+			expectedVM: &testVM{},
+		},
+		{
+			name:        "legacy factory with config",
+			factory:     testFactory{},
+			configBytes: []byte("config"),
+			expectedErr: errConfigNotSupported,
+		},
+		{
+			name:        "config parsed",
+			factory:     testParsingFactory{},
+			configBytes: []byte("config"),
+			expectedVM:  testParsedConfig{name: "config"},
+		},
+		{
+			name:        "config rejected",
+			factory:     testParsingFactory{},
+			expectedErr: errTestInvalidConfig,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			vm, err := NewWithConfig(context.Background(), test.factory, log.NewNoOpLogger(), test.configBytes)
+			require.ErrorIs(err, test.expectedErr)
+			require.Equal(test.expectedVM, vm)
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		factory        Factory
+		configBytes    []byte
+		expectedConfig interface{}
+		expectedErr    error
+	}{
+		{
+			name:           "config parsed",
+			factory:        testParsingFactory{},
+			configBytes:    []byte("config"),
+			expectedConfig: testParsedConfig{name: "config"},
+		},
+		{
+			name:        "config rejected",
+			factory:     testParsingFactory{},
+			expectedErr: errInvalidConfig,
+		},
+		{
+			name:           "config passed through",
+			factory:        testConfigFactory{},
+			configBytes:    []byte("config"),
+			expectedConfig: []byte("config"),
+		},
+		{
+			name:        "legacy factory with config",
+			factory:     testFactory{},
+			configBytes: []byte("config"),
+			expectedErr: errConfigNotSupported,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			config, err := ParseConfig(test.factory, test.configBytes)
+			require.ErrorIs(err, test.expectedErr)
+			require.Equal(test.expectedConfig, config)
+			if err != nil {
+				return
+			}
+
+			vm, err := NewWithParsedConfig(context.Background(), test.factory, log.NewNoOpLogger(), config)
+			require.NoError(err)
+			require.NotNil(vm)
+		})
+	}
+}
+
+func TestNewWithParsedConfigUnexpectedConfig(t *testing.T) {
+	_, err := NewWithParsedConfig(context.Background(), testConfigFactory{}, log.NewNoOpLogger(), testParsedConfig{})
+	require.ErrorIs(t, err, errUnexpectedConfig)
+}
+
+func TestFactoryFunc(t *testing.T) {
+	require := require.New(t)
+
+	logger := log.NewNoOpLogger()
+	var f Factory = FactoryFunc(func(log log.Logger) (interface{}, error) {
+		require.Equal(logger, log)
+		return &testVM{}, nil
+	})
+	vm, err := f.New(logger)
+	require.NoError(err)
+	require.Equal(&testVM{}, vm)
+}
+
+func TestTypedFactory(t *testing.T) {
+	require := require.New(t)
+
+	vm, err := NewTypedFactory[*testVM](testFactory{}).New(log.NewNoOpLogger())
+	require.NoError(err)
+	require.Equal(&testVM{}, vm)
+
+	_, err = NewTypedFactory[*testConfigFactory](testFactory{}).New(log.NewNoOpLogger())
+	require.ErrorIs(err, errUnexpectedVMType)
+}
+
+func TestHealthCheck(t *testing.T) {
+	tests := []struct {
+		name            string
+		factory         Factory
+		expectedDetails interface{}
+		expectedErr     error
+	}{
+		{
+			name:    "factory without health check",
+			factory: testFactory{},
+		},
+		{
+			name: "healthy factory",
+			factory: testHealthyFactory{
+				details: "ok",
+			},
+			expectedDetails: "ok",
+		},
+		{
+			name: "unhealthy factory",
+			factory: testHealthyFactory{
+				details: "missing plugin",
+				err:     errTestUnhealthy,
+			},
+			expectedDetails: "missing plugin",
+			expectedErr:     errTestUnhealthy,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			details, err := HealthCheck(context.Background(), test.factory)
+			require.ErrorIs(err, test.expectedErr)
+			require.Equal(test.expectedDetails, details)
+		})
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	tests := []struct {
+		name        string
+		factory     Factory
+		enabled     Capabilities
+		expectedErr error
+	}{
+		{
+			name:    "factory without capabilities",
+			factory: testFactory{},
+		},
+		{
+			name: "capabilities enabled",
+			factory: testCapableFactory{
+				capabilities: StateSync | WarpMessenger,
+			},
+			enabled: StateSync | ContextVerification | WarpMessenger,
+		},
+		{
+			name: "capability missing",
+			factory: testCapableFactory{
+				capabilities: StateSync | WarpMessenger,
+			},
+			enabled:     StateSync,
+			expectedErr: errMissingCapability,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckCapabilities(test.factory, test.enabled)
+			require.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
+
+func TestCapabilitiesString(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("none", DefaultCapabilities.String())
+	require.Equal("StateSync|WarpMessenger", (StateSync | WarpMessenger).String())
+	require.Equal("ContextVerification|0x10", (ContextVerification | 1<<4).String())
+}
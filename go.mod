@@ -12,7 +12,10 @@ require (
 	github.com/luxfi/log v1.1.26
 	github.com/luxfi/math v1.1.0
 	github.com/luxfi/metric v1.4.8
+	github.com/luxfi/utils v1.1.0
+	github.com/prometheus/client_model v0.6.2
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sync v0.19.0
 )
 
 require (
@@ -47,14 +50,12 @@ require (
 	github.com/luxfi/mock v0.1.0 // indirect
 	github.com/luxfi/node v1.22.14 // indirect
 	github.com/luxfi/p2p v1.4.6 // indirect
-	github.com/luxfi/utils v1.1.0 // indirect
 	github.com/luxfi/warp v1.16.36 // indirect
 	github.com/mr-tron/base58 v1.2.0 // indirect
 	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
 	github.com/prometheus/client_golang v1.23.2 // indirect
-	github.com/prometheus/client_model v0.6.2 // indirect
 	github.com/prometheus/common v0.67.4 // indirect
 	github.com/prometheus/procfs v0.19.2 // indirect
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
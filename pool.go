@@ -0,0 +1,91 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/luxfi/log"
+)
+
+var (
+	_ Factory = (*PooledFactory)(nil)
+
+	errNotResettable = errors.New("VM does not implement Resetter")
+)
+
+// Resetter is a VM that can be returned to a clean state, so that it can be
+// handed out again by a PooledFactory.
+type Resetter interface {
+	// Reset returns the VM to the state it was in when it was created.
+	Reset() error
+}
+
+// PooledFactory is a Factory that reuses released VMs rather than creating
+// new ones. It is intended for test harnesses that create many short-lived
+// VMs. It is safe for concurrent use.
+type PooledFactory struct {
+	factory Factory
+	maxIdle int
+
+	lock sync.Mutex
+	idle []interface{}
+}
+
+// NewPooledFactory returns a PooledFactory that retains up to [maxIdle]
+// released VMs and creates VMs with [f] when none are idle.
+func NewPooledFactory(f Factory, maxIdle int) *PooledFactory {
+	return &PooledFactory{
+		factory: f,
+		maxIdle: maxIdle,
+	}
+}
+
+// New returns an idle VM if there is one, and otherwise creates a new VM with
+// the wrapped factory. Idle VMs keep the logger they were created with, so
+// [log] is only used when creating a new VM.
+func (f *PooledFactory) New(log log.Logger) (interface{}, error) {
+	f.lock.Lock()
+	if numIdle := len(f.idle); numIdle > 0 {
+		vm := f.idle[numIdle-1]
+		f.idle[numIdle-1] = nil
+		f.idle = f.idle[:numIdle-1]
+		f.lock.Unlock()
+		return vm, nil
+	}
+	f.lock.Unlock()
+
+	return f.factory.New(log)
+}
+
+// Release resets [vm] and returns it to the pool. If the pool is full, [vm] is
+// dropped. An error is returned if [vm] is not a Resetter or fails to reset,
+// in which case it is not returned to the pool.
+func (f *PooledFactory) Release(vm interface{}) error {
+	resetter, ok := vm.(Resetter)
+	if !ok {
+		return fmt.Errorf("%w: %T", errNotResettable, vm)
+	}
+	if err := resetter.Reset(); err != nil {
+		return err
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(f.idle) < f.maxIdle {
+		f.idle = append(f.idle, vm)
+	}
+	return nil
+}
+
+// Idle returns the number of VMs waiting in the pool.
+func (f *PooledFactory) Idle() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.idle)
+}
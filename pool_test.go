@@ -0,0 +1,82 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/luxfi/log"
+)
+
+var (
+	_ Resetter = (*testResettableVM)(nil)
+
+	errTestReset = errors.New("test reset")
+)
+
+type testResettableVM struct {
+	dirty  bool
+	resetV error
+}
+
+func (vm *testResettableVM) Reset() error {
+	if vm.resetV != nil {
+		return vm.resetV
+	}
+	vm.dirty = false
+	return nil
+}
+
+type testCountingFactory struct {
+	created int
+}
+
+func (f *testCountingFactory) New(log.Logger) (interface{}, error) {
+	f.created++
+	return &testResettableVM{}, nil
+}
+
+func TestPooledFactory(t *testing.T) {
+	require := require.New(t)
+
+	factory := &testCountingFactory{}
+	pool := NewPooledFactory(factory, 1)
+	logger := log.NewNoOpLogger()
+
+	vm0, err := pool.New(logger)
+	require.NoError(err)
+	vm1, err := pool.New(logger)
+	require.NoError(err)
+	require.Equal(2, factory.created)
+
+	// Released VMs are reset and handed out again.
+	vm0.(*testResettableVM).dirty = true
+	require.NoError(pool.Release(vm0))
+	require.Equal(1, pool.Idle())
+	vm, err := pool.New(logger)
+	require.NoError(err)
+	require.Same(vm0, vm)
+	require.False(vm.(*testResettableVM).dirty)
+	require.Equal(2, factory.created)
+
+	// VMs beyond the pool size are dropped.
+	require.NoError(pool.Release(vm0))
+	require.NoError(pool.Release(vm1))
+	require.Equal(1, pool.Idle())
+
+	// VMs that fail to reset aren't pooled.
+	_, err = pool.New(logger)
+	require.NoError(err)
+	require.ErrorIs(pool.Release(&testResettableVM{resetV: errTestReset}), errTestReset)
+	require.ErrorIs(pool.Release(&testVM{}), errNotResettable)
+	require.Zero(pool.Idle())
+
+	// The wrapped factory is used once the pool is empty.
+	_, err = pool.New(logger)
+	require.NoError(err)
+	require.Equal(3, factory.created)
+}
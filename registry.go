@@ -0,0 +1,64 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+var (
+	errUnknownVM   = errors.New("unknown VM")
+	errDuplicateVM = errors.New("duplicate VM")
+)
+
+// Registry maps VM names to the factories that create them. It is safe for
+// concurrent use.
+type Registry struct {
+	lock      sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]Factory),
+	}
+}
+
+// Register adds [f] to the registry under [name]. Returns an error if [name]
+// is already registered.
+func (r *Registry) Register(name string, f Factory) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("%w: %q", errDuplicateVM, name)
+	}
+	r.factories[name] = f
+	return nil
+}
+
+// Get returns the factory registered under [name].
+func (r *Registry) Get(name string) (Factory, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	f, ok := r.factories[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownVM, name)
+	}
+	return f, nil
+}
+
+// List returns the names of all the registered VMs in sorted order.
+func (r *Registry) List() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.factories))
+}
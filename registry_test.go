@@ -0,0 +1,30 @@
+// Copyright (C) 2019-2025, Lux Industries, Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	require := require.New(t)
+
+	r := NewRegistry()
+	require.Empty(r.List())
+
+	_, err := r.Get("foo")
+	require.ErrorIs(err, errUnknownVM)
+
+	require.NoError(r.Register("foo", testFactory{}))
+	require.NoError(r.Register("bar", testConfigFactory{}))
+	err = r.Register("foo", testConfigFactory{})
+	require.ErrorIs(err, errDuplicateVM)
+
+	f, err := r.Get("foo")
+	require.NoError(err)
+	require.Equal(testFactory{}, f)
+	require.Equal([]string{"bar", "foo"}, r.List())
+}